@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"poolpro/go-api/internal/handlers"
+	"poolpro/go-api/internal/services"
 )
 
 func validateEnv() {
@@ -14,11 +15,59 @@ func validateEnv() {
 	}
 }
 
+// loadRuleSets validates the dosing rule set file at startup so a bad file
+// fails the deploy instead of the first request.
+func loadRuleSets() {
+	path := os.Getenv("GO_DOSING_RULES_FILE")
+	if path == "" {
+		return
+	}
+	if err := services.LoadRuleSets(path); err != nil {
+		log.Fatalf("invalid dosing rules: %v", err)
+	}
+	log.Printf("loaded dosing rule sets from %s", path)
+}
+
+// loadPriceBooks replaces the builtin estimate prices with the configured
+// price book.
+func loadPriceBooks() {
+	path := os.Getenv("GO_PRICE_BOOK_FILE")
+	if path == "" {
+		return
+	}
+	if err := services.LoadPriceBooks(path); err != nil {
+		log.Fatalf("invalid price book: %v", err)
+	}
+	log.Printf("loaded price book from %s", path)
+}
+
+// loadMeasureCatalog replaces the builtin jugs, scoops and cups used to
+// phrase doses in practical measures.
+func loadMeasureCatalog() {
+	path := os.Getenv("GO_MEASURE_CATALOG_FILE")
+	if path == "" {
+		return
+	}
+	if err := services.LoadMeasureCatalog(path); err != nil {
+		log.Fatalf("invalid measure catalog: %v", err)
+	}
+	log.Printf("loaded measure catalog from %s", path)
+}
+
 func main() {
 	validateEnv()
+	loadRuleSets()
+	loadPriceBooks()
+	loadMeasureCatalog()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v1/healthz", handlers.Health)
 	mux.HandleFunc("/api/v1/calculator/dose", handlers.Calculator)
+	mux.HandleFunc("/api/v1/calculator/products", handlers.ChlorineProducts)
+	mux.HandleFunc("/api/v1/calculator/saturation", handlers.Saturation)
+	mux.HandleFunc("/api/v1/calculator/volume", handlers.Volume)
+	mux.HandleFunc("/api/v1/calculator/simulate", handlers.Simulate)
+	mux.HandleFunc("/api/v1/calculator/shock", handlers.ShockPlan)
+	mux.HandleFunc("/api/v1/calculator/demand", handlers.ChlorineDemand)
 	mux.HandleFunc("/api/v1/diagnose", handlers.Diagnose)
 	port := os.Getenv("GO_API_PORT")
 	if port == "" {
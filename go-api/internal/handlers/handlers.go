@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"poolpro/go-api/internal/services"
 )
@@ -20,6 +21,55 @@ func Calculator(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(services.CalculateDosing(in))
 }
 
+func ChlorineProducts(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{"chlorine": services.ChlorineProducts()})
+}
+
+func Volume(w http.ResponseWriter, r *http.Request) {
+	var in services.VolumeInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(services.EstimateVolume(in))
+}
+
+func Simulate(w http.ResponseWriter, r *http.Request) {
+	var in services.SimulateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(services.Simulate(in))
+}
+
+func Saturation(w http.ResponseWriter, r *http.Request) {
+	var in services.SaturationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(services.CalculateSaturation(in))
+}
+
+func ShockPlan(w http.ResponseWriter, r *http.Request) {
+	var in services.ShockPlanInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(services.PlanShock(in))
+}
+
+func ChlorineDemand(w http.ResponseWriter, r *http.Request) {
+	var in services.ChlorineDemandInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(services.EstimateChlorineDemand(in))
+}
+
 func Diagnose(w http.ResponseWriter, r *http.Request) {
 	var body services.DiagnoseRequest
 	decoder := json.NewDecoder(r.Body)
@@ -33,20 +83,29 @@ func Diagnose(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	issues := services.CheckDiagnoseContext(body.Context, time.Now())
 	plan := services.BuildFallbackPlanWithContext(body.Symptoms, body.Context)
 	source := "fallback"
 	var warning string
 	if services.HasOpenAIKey() {
 		if llmPlan, err := services.GenerateDiagnosePlan(body.Symptoms, body.Context); err == nil {
-			plan = llmPlan
+			plan = services.ApplyReadingIssues(llmPlan, issues)
+			plan.EstimatedCost = services.PlanCost(plan, tenantOf(body.Context))
 			source = "llm"
 		} else {
 			warning = "LLM response unavailable or invalid; returned conservative fallback plan."
 		}
 	}
-	resp := map[string]any{"plan": plan, "source": source}
+	resp := map[string]any{"plan": plan, "source": source, "readingIssues": issues}
 	if warning != "" {
 		resp["warning"] = warning
 	}
 	json.NewEncoder(w).Encode(resp)
 }
+
+func tenantOf(ctx *services.DiagnoseContext) string {
+	if ctx == nil {
+		return ""
+	}
+	return ctx.Tenant
+}
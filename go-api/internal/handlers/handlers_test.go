@@ -46,6 +46,22 @@ func TestDiagnoseFallbackWithoutKey(t *testing.T) {
 	}
 }
 
+func TestDiagnoseReturnsReadingIssues(t *testing.T) {
+	body := []byte(`{"poolId":"pool_1","context":{"latestTest":{"fc":2,"cc":3,"tc":2.5}}}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/diagnose", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	Diagnose(w, r)
+	var out struct {
+		ReadingIssues []map[string]string `json:"readingIssues"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if len(out.ReadingIssues) != 1 || out.ReadingIssues[0]["severity"] != "severe" {
+		t.Fatalf("expected severe CC issue, got %v", out.ReadingIssues)
+	}
+}
+
 func TestDiagnoseInvalidBody(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/api/v1/diagnose", strings.NewReader(`{"poolId"`))
 	w := httptest.NewRecorder()
@@ -54,3 +70,104 @@ func TestDiagnoseInvalidBody(t *testing.T) {
 		t.Fatalf("expected 400 got %d", w.Code)
 	}
 }
+
+func TestSaturation(t *testing.T) {
+	body := []byte(`{"test":{"ph":7.5,"ta":80,"ch":300,"cya":30,"tempF":80},"surfaceType":"plaster"}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/calculator/saturation", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	Saturation(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if out["status"] != "balanced" {
+		t.Fatalf("expected balanced status, got %v", out["status"])
+	}
+}
+
+func TestShockPlan(t *testing.T) {
+	body := []byte(`{"poolVolumeGallons":20000,"readings":{"fc":1,"cc":2,"cya":50},"day":1}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/calculator/shock", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	ShockPlan(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if out["shockLevel"] != float64(20) {
+		t.Fatalf("expected shock level 20, got %v", out["shockLevel"])
+	}
+}
+
+func TestChlorineDemand(t *testing.T) {
+	body := []byte(`{"overnightLoss":{"eveningFc":8,"morningFc":5.5,"hours":10}}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/calculator/demand", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	ChlorineDemand(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if out["status"] != "organic_load" || out["overnightLossPpm"] != 2.5 {
+		t.Fatalf("expected failed OCLT, got %v", out)
+	}
+}
+
+func TestChlorineProducts(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/calculator/products", nil)
+	w := httptest.NewRecorder()
+	ChlorineProducts(w, r)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "dichlor") {
+		t.Fatalf("expected catalog response, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestVolume(t *testing.T) {
+	body := []byte(`{"shape":"rectangular","length":32,"width":16,"shallowDepth":3.5,"deepDepth":6.5}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/calculator/volume", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	Volume(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if out["poolVolumeGallons"] != float64(19150) {
+		t.Fatalf("expected 19150 gallons, got %v", out["poolVolumeGallons"])
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	body := []byte(`{"poolVolumeGallons":10000,"readings":{"ch":200},"doses":[{"chemical":"calcium_chloride","amount":12.5,"unit":"lb"}]}`)
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/calculator/simulate", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	Simulate(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var out struct {
+		After map[string]float64 `json:"after"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	if out.After["ch"] != 300 {
+		t.Fatalf("expected CH 300, got %v", out.After["ch"])
+	}
+}
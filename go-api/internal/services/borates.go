@@ -0,0 +1,58 @@
+package services
+
+import "fmt"
+
+// Borate range in ppm (as boron). Borates add pH buffering around 7.5 and
+// slow algae; above the unsafe level they are a hazard to pets drinking the
+// water.
+const (
+	borateMinimum = 30
+	borateMaximum = 50
+	borateUnsafe  = 60
+)
+
+// boratesProduct raises borates. LbPerPPMPer10k is the amount that adds
+// 1 ppm boron to 10k gallons.
+type boratesProduct struct {
+	Chemical       string
+	LbPerPPMPer10k float64
+	CapLb          float64
+	Notes          string
+}
+
+var boratesProducts = map[string]boratesProduct{
+	"boric_acid": {"boric_acid", 0.477, 25, "Broadcast slowly around the deep end with the pump running, or pre-dissolve in warm water. Lowers pH slightly."},
+	"borax":      {"sodium_tetraborate_decahydrate", 1 / (boratesPerBoraxOz * 16), 40, "Raises pH sharply; add muriatic acid alongside to hold pH in range and retest before the next portion."},
+}
+
+// borateDose sizes the addition that raises borates to target with the
+// selected product (Products["borates"]: "boric_acid", the default, or
+// "borax").
+func borateDose(in CalcInput, pool float64, out *CalcOutput) {
+	if b, ok := in.Readings["borates"]; ok && b > borateUnsafe {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("Borates are %.0f ppm, above the %d ppm safe limit; dilute and keep pets from drinking the water.", b, borateUnsafe))
+	}
+	t, r, ok := targetAbove(in, "borates")
+	if !ok {
+		return
+	}
+	if t < borateMinimum || t > borateMaximum {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("Borate target %.0f ppm is outside the %d-%d ppm range.", t, borateMinimum, borateMaximum))
+	}
+	key := in.Products["borates"]
+	product, found := boratesProducts[key]
+	if !found {
+		if key != "" {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown borates product %q; dosed as boric acid.", key))
+		}
+		product = boratesProducts["boric_acid"]
+	}
+	lbs := capDose((t-r)*(pool/10000)*product.LbPerPPMPer10k, doseCap(in, pool, product.CapLb))
+	out.Doses = append(out.Doses, Dose{product.Chemical, lbs, "lb", product.Notes, ""})
+}
+
+// borateFactor is how much harder borates make pH to move in either
+// direction.
+func borateFactor(readings map[string]float64) float64 {
+	return 1 + readings["borates"]/100
+}
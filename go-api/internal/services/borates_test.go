@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingBoricAcid(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"borates": 0, "cya": 30},
+		Targets:           map[string]float64{"borates": 40},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "boric_acid" || out.Doses[0].Amount != 19.08 || out.Doses[0].Unit != "lb" {
+		t.Fatalf("unexpected borate dose: %+v", out.Doses)
+	}
+	if len(out.Warnings) != 0 {
+		t.Fatalf("expected no warnings for an in-range target, got %v", out.Warnings)
+	}
+}
+
+func TestCalculateDosingBoraxCappedAndWarned(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Products:          map[string]string{"borates": "borax"},
+		Readings:          map[string]float64{"borates": 20, "cya": 30},
+		Targets:           map[string]float64{"borates": 60},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "sodium_tetraborate_decahydrate" || out.Doses[0].Amount != 40 {
+		t.Fatalf("expected borax capped at 40 lb, got %+v", out.Doses)
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "outside the 30-50") {
+		t.Fatalf("expected range warning, got %v", out.Warnings)
+	}
+}
+
+func TestCalculateDosingBoratesSlowPHDrop(t *testing.T) {
+	in := CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"ph": 8.0, "ta": 100, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.5},
+	}
+	plain := CalculateDosing(in)
+	in.Readings["borates"] = 50
+	buffered := CalculateDosing(in)
+	if plain.Doses[0].Amount != 6 || buffered.Doses[0].Amount != 9 {
+		t.Fatalf("expected borates to scale acid 6 -> 9 oz, got %v and %v", plain.Doses[0].Amount, buffered.Doses[0].Amount)
+	}
+}
+
+func TestSimulateBoricAcid(t *testing.T) {
+	out := Simulate(SimulateInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"borates": 0},
+		Doses:             []Dose{{"boric_acid", 19.08, "lb", "", ""}},
+	})
+	if out.After["borates"] != 40 {
+		t.Fatalf("expected borates 40, got %v", out.After)
+	}
+}
+
+func TestBuildFallbackPlanFlagsHighBorates(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("", &DiagnoseContext{LatestTest: &DiagnoseWaterTest{Borates: floatPtr(80)}})
+	if !strings.Contains(strings.Join(plan.Steps, " | "), "safe limit") {
+		t.Fatalf("expected borate step, got %v", plan.Steps)
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bromine targets in ppm. Bromine is measured as total bromine and is not
+// stabilized by CYA, so unlike chlorine the targets are fixed numbers.
+const (
+	bromineMinimum = 3
+	bromineTarget  = 4
+	bromineMaximum = 6
+	// bromideBankTarget is the sodium bromide reserve an oxidizer converts
+	// back into bromine.
+	bromideBankTarget = 15
+)
+
+const (
+	// brPerPPMChlorine: 1 ppm FC oxidizes bromide into 2.25 ppm bromine.
+	brPerPPMChlorine = 2.25
+	// bromideOzPerPPMPer10k is sodium bromide that adds 1 ppm bromide.
+	bromideOzPerPPMPer10k = 1.72
+	// mpsOzPerPPMBrPer10k is potassium monopersulfate that regenerates 1 ppm
+	// bromine from the bank.
+	mpsOzPerPPMBrPer10k = 2.97
+	bromideCapOz        = 96
+	mpsCapOz            = 64
+	// mpsFallbackOzPer10k is the fallback plan's non-chlorine shock.
+	mpsFallbackOzPer10k = 16
+)
+
+func isBromine(sanitizerType string) bool {
+	return strings.EqualFold(strings.TrimSpace(sanitizerType), "bromine")
+}
+
+// bromineDoses builds the bromide bank and regenerates bromine with the
+// selected oxidizer (Products["oxidizer"]: "mps" or chlorine, the default).
+func bromineDoses(in CalcInput, pool float64, out *CalcOutput) {
+	if t, r, ok := targetAbove(in, "bromide"); ok {
+		oz := capDose((t-r)*(pool/10000)*bromideOzPerPPMPer10k, doseCap(in, pool, bromideCapOz))
+		out.Doses = append(out.Doses, Dose{"sodium_bromide", oz, "oz", "Broadcast across the surface with the pump running; builds the bromide bank after a refill.", ""})
+	}
+	t, r, ok := targetAbove(in, "br")
+	if !ok {
+		return
+	}
+	if bank, known := in.Readings["bromide"]; known && bank < bromideBankTarget/2 {
+		if _, building := in.Targets["bromide"]; !building {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("Bromide bank is %.0f ppm; oxidizer cannot regenerate much bromine until the bank is rebuilt toward %d ppm.", bank, bromideBankTarget))
+		}
+	}
+	switch in.Products["oxidizer"] {
+	case "mps":
+		oz := capDose((t-r)*(pool/10000)*mpsOzPerPPMBrPer10k, doseCap(in, pool, mpsCapOz))
+		out.Doses = append(out.Doses, Dose{"potassium_monopersulfate", oz, "oz", "Non-chlorine oxidizer; regenerates bromine from the bank. Add half, circulate 30 min, retest.", ""})
+	default:
+		chlorineIn := in
+		chlorineIn.Products = map[string]string{"chlorine": in.Products["chlorine"]}
+		dose, assumptions, _ := chlorineDose(chlorineIn, pool, (t-r)/brPerPPMChlorine)
+		dose.Notes = "Oxidizes the bromide bank back into bromine. Add half, circulate 30 min, retest bromine."
+		out.Doses = append(out.Doses, dose)
+		out.Assumptions = append(out.Assumptions, assumptions...)
+	}
+}
+
+// bromineFallback replaces the chlorine-centric fallback defaults for
+// bromine pools and spas.
+func bromineFallback(context *DiagnoseContext) (string, []string, map[string]string) {
+	diagnosis := "Likely low bromine or depleted bromide bank."
+	steps := []string{
+		fmt.Sprintf("Test total bromine; keep %d-%d ppm", bromineMinimum, bromineMaximum),
+		"Check the bromine feeder or floater has tablets and is set to deliver",
+		"Shock with a non-chlorine oxidizer to regenerate bromine and burn off waste",
+	}
+	oz := float64(mpsFallbackOzPer10k)
+	if context != nil && context.PoolVolumeGallons != nil {
+		oz = round(*context.PoolVolumeGallons / 10000 * mpsFallbackOzPer10k)
+	}
+	if context != nil && context.LatestTest != nil && context.LatestTest.Bromine != nil {
+		if br := *context.LatestTest.Bromine; br < bromineMinimum {
+			diagnosis = fmt.Sprintf("Bromine is low at %.1f ppm; sanitizer is not keeping up.", br)
+			steps = append(steps, "If the water was recently refilled, rebuild the bromide bank with sodium bromide")
+		} else if br > bromineMaximum+4 {
+			diagnosis = fmt.Sprintf("Bromine is high at %.1f ppm; reduce feeder output and let it drift down.", br)
+			steps = []string{"Turn down or remove the bromine feeder", "Keep bathers out until bromine is below 6 ppm"}
+			oz = 0
+		}
+	}
+	addition := map[string]string{
+		"chemical":     "potassium_monopersulfate",
+		"amount":       fmt.Sprintf("%.0f", oz),
+		"unit":         "oz",
+		"instructions": "Add half now with the pump running, retest bromine in 4 hours.",
+	}
+	if oz == 0 {
+		addition = nil
+	}
+	return diagnosis, steps, addition
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingBromineWithChlorineOxidizer(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		SanitizerType:     "bromine",
+		Readings:          map[string]float64{"br": 1.75, "bromide": 20},
+		Targets:           map[string]float64{"br": 4, "fc": 5},
+	})
+	if out.Confidence != "Medium" {
+		t.Fatalf("expected bromine pool not to require cya, got %s %v", out.Confidence, out.Missing)
+	}
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "liquid_chlorine_10pct" || out.Doses[0].Amount != 12.8 {
+		t.Fatalf("expected 1 ppm FC worth of chlorine to regenerate 2.25 ppm bromine, got %+v", out.Doses)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "FC target ignored") {
+		t.Fatalf("expected FC target to be ignored, got %v", out.Assumptions)
+	}
+}
+
+func TestCalculateDosingBromineBankAndMPS(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		SanitizerType:     "bromine",
+		Products:          map[string]string{"oxidizer": "mps"},
+		Readings:          map[string]float64{"br": 0, "bromide": 0},
+		Targets:           map[string]float64{"br": 4, "bromide": 15},
+	})
+	if len(out.Doses) != 2 {
+		t.Fatalf("expected bromide and oxidizer doses, got %+v", out.Doses)
+	}
+	if out.Doses[0].Chemical != "sodium_bromide" || out.Doses[0].Amount != 51.6 {
+		t.Fatalf("unexpected bromide dose: %+v", out.Doses[0])
+	}
+	if out.Doses[1].Chemical != "potassium_monopersulfate" || out.Doses[1].Amount != 23.8 {
+		t.Fatalf("unexpected MPS dose: %+v", out.Doses[1])
+	}
+	if out.Sequence[0].Chemical != "sodium_bromide" {
+		t.Fatalf("expected bromide bank before oxidizer, got %+v", out.Sequence)
+	}
+}
+
+func TestCalculateDosingBromineWarnsOnEmptyBank(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		SanitizerType:     "bromine",
+		Readings:          map[string]float64{"br": 1, "bromide": 2},
+		Targets:           map[string]float64{"br": 4},
+	})
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "Bromide bank") {
+		t.Fatalf("expected bank warning, got %v", out.Warnings)
+	}
+}
+
+func TestCalculateDosingBromineAutoTarget(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		SanitizerType:     "bromine",
+		AutoTargets:       true,
+		Readings:          map[string]float64{"br": 3.1},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Amount != 5.1 {
+		t.Fatalf("expected a small oxidizer dose toward 4 ppm, got %+v", out.Doses)
+	}
+}
+
+func TestBuildFallbackPlanBromine(t *testing.T) {
+	br := 1.0
+	fc := 0.0
+	volume := 20000.0
+	plan := BuildFallbackPlanWithContext("Cloudy and smells", &DiagnoseContext{
+		SanitizerType:     "bromine",
+		PoolVolumeGallons: &volume,
+		LatestTest:        &DiagnoseWaterTest{Bromine: &br, FC: &fc},
+	})
+	if !strings.Contains(plan.Diagnosis, "Bromine is low") {
+		t.Fatalf("expected bromine diagnosis, got %q", plan.Diagnosis)
+	}
+	addition := plan.ChemicalAdditions[0]
+	if addition["chemical"] != "potassium_monopersulfate" || addition["amount"] != "32" {
+		t.Fatalf("expected 32 oz MPS, got %v", addition)
+	}
+	if strings.Contains(strings.Join(plan.Steps, " "), "liquid chlorine") {
+		t.Fatalf("expected no chlorine steps for bromine pool, got %v", plan.Steps)
+	}
+	if err := ValidateDiagnosePlan(plan); err != nil {
+		t.Fatalf("fallback plan should validate: %v", err)
+	}
+}
+
+func TestBuildDiagnoseUserPromptIncludesBromine(t *testing.T) {
+	br := 2.5
+	prompt := buildDiagnoseUserPrompt("", &DiagnoseContext{SanitizerType: "bromine", LatestTest: &DiagnoseWaterTest{Bromine: &br}})
+	if !strings.Contains(prompt, "- bromine: 2.50") {
+		t.Fatalf("expected bromine reading in prompt:\n%s", prompt)
+	}
+}
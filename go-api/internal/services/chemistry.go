@@ -1,62 +1,441 @@
 package services
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
 
 type CalcInput struct {
 	PoolVolumeGallons float64            `json:"poolVolumeGallons"`
+	PoolVolumeLiters  float64            `json:"poolVolumeLiters,omitempty"`
+	UnitSystem        string             `json:"unitSystem,omitempty"`
 	Readings          map[string]float64 `json:"readings"`
 	Targets           map[string]float64 `json:"targets"`
 	ProductStrengths  map[string]float64 `json:"productStrengths"`
+	Products          map[string]string  `json:"products,omitempty"`
+	SanitizerType     string             `json:"sanitizerType,omitempty"`
+	IsSalt            bool               `json:"isSalt,omitempty"`
+	AutoTargets       bool               `json:"autoTargets,omitempty"`
+	Dilution          *DilutionOptions   `json:"dilution,omitempty"`
+	TALowering        *TALoweringOptions `json:"taLowering,omitempty"`
+	SaltGenerator     *SaltGenerator     `json:"saltGenerator,omitempty"`
+	DailyFCDemand     float64            `json:"dailyFcDemand,omitempty"`
+	FCHistory         []FCReading        `json:"fcHistory,omitempty"`
+	OvernightLoss     *OvernightLossTest `json:"overnightLoss,omitempty"`
+	SurfaceType       string             `json:"surfaceType,omitempty"`
+	Simulate          bool               `json:"simulate,omitempty"`
+	BodyOfWater       string             `json:"bodyOfWater,omitempty"`
+	BathersPerDay     float64            `json:"bathersPerDay,omitempty"`
+	TestedAt          string             `json:"testedAt,omitempty"`
+	RuleSet           string             `json:"ruleSet,omitempty"`
+	Tenant            string             `json:"tenant,omitempty"`
+	TestMethod        string             `json:"testMethod,omitempty"`
+	TestMethods       map[string]string  `json:"testMethods,omitempty"`
+	Enzyme            string             `json:"enzyme,omitempty"`
+
+	rules *RuleSet
+	// baseUnits leaves doses unrounded in imperial oz and lb, for reruns
+	// whose amounts are converted afterwards.
+	baseUnits bool
 }
 
 type Dose struct {
-	Chemical string  `json:"chemical"`
-	Amount   float64 `json:"amount"`
-	Unit     string  `json:"unit"`
-	Notes    string  `json:"notes"`
+	Chemical  string  `json:"chemical"`
+	Amount    float64 `json:"amount"`
+	Unit      string  `json:"unit"`
+	Notes     string  `json:"notes"`
+	Practical string  `json:"practical,omitempty"`
 }
 
 type CalcOutput struct {
-	Confidence  string   `json:"confidence"`
-	Doses       []Dose   `json:"doses"`
-	Assumptions []string `json:"assumptions"`
-	SafetyNotes []string `json:"safetyNotes"`
-	Missing     []string `json:"missingFields"`
-	RetestHours int      `json:"retestInHours"`
+	Confidence         string                 `json:"confidence"`
+	Doses              []Dose                 `json:"doses"`
+	Assumptions        []string               `json:"assumptions"`
+	SafetyNotes        []string               `json:"safetyNotes"`
+	Missing            []string               `json:"missingFields"`
+	RetestHours        int                    `json:"retestInHours"`
+	Warnings           []string               `json:"warnings,omitempty"`
+	UnitSystem         string                 `json:"unitSystem"`
+	Dilution           *DilutionPlan          `json:"dilution,omitempty"`
+	TALowering         *TALoweringPlan        `json:"taLowering,omitempty"`
+	ChlorineDemand     *ChlorineDemand        `json:"chlorineDemand,omitempty"`
+	MaintenanceDose    *Dose                  `json:"maintenanceDose,omitempty"`
+	SaltGenerator      *SaltGeneratorGuidance `json:"saltGenerator,omitempty"`
+	Predicted          *SimulateOutput        `json:"predicted,omitempty"`
+	Sequence           []SequenceStep         `json:"sequence"`
+	VisitMinutes       int                    `json:"visitMinutes"`
+	BodyOfWater        string                 `json:"bodyOfWater"`
+	TargetProfile      string                 `json:"targetProfile"`
+	TargetRanges       map[string]TargetRange `json:"targetRanges,omitempty"`
+	RefillInDays       int                    `json:"refillInDays,omitempty"`
+	ReadingIssues      []ReadingIssue         `json:"readingIssues"`
+	RuleSetVersion     string                 `json:"ruleSetVersion"`
+	ReadingUncertainty map[string]float64     `json:"readingUncertainty,omitempty"`
+	DoseRanges         []DoseRange            `json:"doseRanges,omitempty"`
+	Cost               *CostEstimate          `json:"cost,omitempty"`
 }
 
+// liquidChlorineCapOz is the largest single liquid chlorine addition we emit.
+const liquidChlorineCapOz = 512
+
+// Rule-of-thumb rates per 10k gallons, shared with the simulator which runs
+// them in reverse. These are the builtin rule set; a loaded rule set can
+// override them per request.
+const (
+	acidOzPer10kPerPH       = 12
+	bicarbLbPer10PPMPer10k  = 1.4
+	calciumLbPer10PPMPer10k = 1.25
+	cyaOzPer10PPMPer10k     = 13
+	defaultTA               = 90
+)
+
+// CalculateDosing mirrors lib/chemistry/dosing.ts for readings that have an
+// explicit target; a measured reading without one is filled from the target
+// profile. The golden vectors in testdata/dosing_golden.json set a target for
+// every reading and are run against both implementations.
 func CalculateDosing(in CalcInput) CalcOutput {
-	out := CalcOutput{RetestHours: 4, Confidence: "Medium", Assumptions: []string{"Conservative first-step dosing."}, SafetyNotes: []string{"Always retest before additional dosing."}}
-	if in.PoolVolumeGallons <= 0 {
-		out.Missing = append(out.Missing, "poolVolumeGallons")
-		out.Confidence = "Low"
-		return out
+	orig := in
+	out := CalcOutput{
+		Doses:   []Dose{},
+		Missing: []string{},
+		Assumptions: []string{
+			"Conservative first-step dosing. Exact demand varies by water conditions and product brand.",
+			"Never mix chemicals directly. Add one chemical at a time with circulation running.",
+		},
+		SafetyNotes: []string{
+			"Wear PPE and follow manufacturer labels.",
+			"Always retest before additional dosing.",
+		},
+	}
+	system, err := resolveUnitSystem(in.UnitSystem)
+	if err != nil {
+		out.Assumptions = append(out.Assumptions, err.Error()+"; using imperial.")
+	}
+	out.UnitSystem = system
+	body, err := resolveBodyOfWater(in.BodyOfWater)
+	if err != nil {
+		out.Assumptions = append(out.Assumptions, err.Error()+"; using pool.")
+	}
+	in.BodyOfWater, out.BodyOfWater = body, body
+	rules, err := resolveRuleSet(in.RuleSet, in.Tenant)
+	if err != nil {
+		out.Assumptions = append(out.Assumptions, err.Error()+"; using "+rules.Version+".")
+	}
+	in.rules, out.RuleSetVersion = &rules, rules.Version
+	bodyProfile := waterBodyProfiles[body]
+	out.RetestHours = bodyProfile.RetestHours
+	if body == BodyPool {
+		out.RetestHours = rules.RetestHours
 	}
 	pool := in.PoolVolumeGallons
-	lc := in.ProductStrengths["liquidChlorinePercent"]
-	if lc == 0 {
-		lc = 10
+	if system == UnitsMetric && in.PoolVolumeLiters > 0 {
+		pool = litersToGallons(in.PoolVolumeLiters)
+	}
+	if pool <= 0 {
+		if system == UnitsMetric {
+			out.Missing = append(out.Missing, "poolVolumeLiters")
+		} else {
+			out.Missing = append(out.Missing, "poolVolumeGallons")
+		}
 	}
-	if t, ok := in.Targets["fc"]; ok {
-		if r, ok2 := in.Readings["fc"]; ok2 && t > r {
-			delta := t - r
-			oz := math.Min((delta*pool)/(10000*lc)*128, 512)
-			out.Doses = append(out.Doses, Dose{"liquid_chlorine", round(oz), "oz", "Add half, circulate, retest."})
+	profile := targetProfile(in, &out)
+	out.TargetProfile, out.TargetRanges = profile.Name, profile.Ranges
+	in.Targets = autoFillTargets(in, profile, &out)
+	out.ReadingIssues = CheckReadings(in.Readings, in.TestedAt, isSaltPool(in), time.Now())
+	blocked := worstIssue(out.ReadingIssues) == IssueSevere
+	if blocked {
+		out.Assumptions = append(out.Assumptions, "Dosing blocked: one or more readings are implausible; retest before adding chemicals.")
+	}
+	bromine := isBromine(in.SanitizerType)
+	if len(in.FCHistory) > 0 || in.OvernightLoss != nil {
+		demand := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: in.FCHistory, OvernightLoss: in.OvernightLoss})
+		out.ChlorineDemand = &demand
+		if in.DailyFCDemand <= 0 && demand.DailyDemand > 0 {
+			in.DailyFCDemand = demand.DailyDemand
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Daily FC demand estimated at %.1f ppm from FC history.", demand.DailyDemand))
+		}
+		if demand.Status == DemandOrganicLoad {
+			out.Warnings = append(out.Warnings, "Chlorine demand indicates organic load or algae; maintenance dosing will not keep up until the pool is shocked.")
 		}
 	}
-	if t, ok := in.Targets["ta"]; ok {
-		if r, ok2 := in.Readings["ta"]; ok2 && t > r {
-			lbs := math.Min(((t-r)/10)*(pool/10000)*1.4, 25)
-			out.Doses = append(out.Doses, Dose{"sodium_bicarbonate", round(lbs), "lb", "Split additions."})
+	if pool > 0 && !blocked {
+		if bromine {
+			if _, ok := in.Targets["fc"]; ok {
+				out.Assumptions = append(out.Assumptions, "Bromine pool: FC target ignored; dosed from bromine readings.")
+			}
+			bromineDoses(in, pool, &out)
+		} else if t, r, ok := targetAbove(in, "fc"); ok {
+			dose, assumptions, warnings := chlorineDose(in, pool, t-r)
+			out.Doses = append(out.Doses, dose)
+			out.Assumptions = append(out.Assumptions, assumptions...)
+			out.Warnings = append(out.Warnings, warnings...)
+		}
+		if t, r, ok := targetBelow(in, "ph"); ok {
+			ta, hasTA := in.Readings["ta"]
+			if !hasTA {
+				ta = rules.DefaultTA
+			}
+			ozPer10k := (r - t) * rules.AcidOzPer10kPerPH * (ta / 100) * borateFactor(in.Readings)
+			oz := cappedDose(ozPer10k*(pool/10000), doseCap(in, pool, rules.AcidCapOz), "muriatic_acid_31_45pct", "oz", &out.Assumptions)
+			out.Doses = append(out.Doses, Dose{"muriatic_acid_31_45pct", oz, "oz", "Conservative first-step estimate; pre-dilute and pour slowly with pump running.", ""})
+		}
+		if t, r, ok := targetAbove(in, "ph"); ok {
+			dose, assumptions := phIncreaseDose(in, pool, t-r)
+			out.Doses = append(out.Doses, dose)
+			out.Assumptions = append(out.Assumptions, assumptions...)
+		}
+		if t, r, ok := targetAbove(in, "ta"); ok {
+			lbs := cappedDose(((t-r)/10)*(pool/10000)*rules.BicarbLbPer10PPMPer10k, doseCap(in, pool, rules.BicarbCapLb), "sodium_bicarbonate", "lb", &out.Assumptions)
+			out.Doses = append(out.Doses, Dose{"sodium_bicarbonate", lbs, "lb", "Split into 2 additions if >5 lb.", ""})
+		}
+		if t, r, ok := targetAbove(in, "ch"); ok {
+			lbs := cappedDose(((t-r)/10)*(pool/10000)*rules.CalciumLbPer10PPMPer10k, doseCap(in, pool, rules.CalciumCapLb), "calcium_chloride", "lb", &out.Assumptions)
+			out.Doses = append(out.Doses, Dose{"calcium_chloride", lbs, "lb", "Dissolve as directed; add in portions.", ""})
+		}
+		if t, r, ok := targetAbove(in, "cya"); ok {
+			oz := cappedDose(((t-r)/10)*(pool/10000)*rules.CYAOzPer10PPMPer10k, doseCap(in, pool, rules.CYACapOz), "cyanuric_acid", "oz", &out.Assumptions)
+			out.Doses = append(out.Doses, Dose{"cyanuric_acid", oz, "oz", "Add via sock method; avoid backwashing for 24-48h.", ""})
+		}
+		borateDose(in, pool, &out)
+		phosphateDose(in, pool, &out)
+		enzymeDose(in, pool, &out)
+		metalsDose(in, pool, &out)
+		if !bromine && !isSaltPool(in) && in.DailyFCDemand > 0 {
+			out.MaintenanceDose = maintenanceChlorine(in, pool, &out)
+		}
+		if isSaltPool(in) {
+			spec := saltGeneratorSpec(in)
+			if t, r, ok := targetAbove(in, "salt"); ok {
+				dose, warnings := saltDose(spec, pool, r, t)
+				out.Doses = append(out.Doses, dose)
+				out.Warnings = append(out.Warnings, warnings...)
+			}
+			out.SaltGenerator = saltGeneratorGuidance(in, spec, pool, &out)
+		}
+		if body != BodyPool {
+			spaRefill(in, pool, &out)
+		}
+		if in.TALowering != nil {
+			out.TALowering = planTALowering(in, pool, &out)
+		} else if _, _, ok := targetBelow(in, "ta"); ok {
+			out.Assumptions = append(out.Assumptions, "TA is above target; set taLowering to plan acid and aeration cycles.")
+		}
+		if in.Dilution != nil {
+			out.Dilution = planDilution(in, pool, &out)
+		} else {
+			dilutionNeeded(in, &out)
+		}
+		if in.Simulate {
+			predicted := Simulate(SimulateInput{PoolVolumeGallons: pool, SurfaceType: in.SurfaceType, SanitizerType: in.SanitizerType, Readings: in.Readings, Doses: out.Doses, rules: &rules})
+			out.Predicted = &predicted
 		}
 	}
-	if _, ok := in.Readings["cya"]; !ok {
+
+	if bromine {
+		if _, ok := in.Readings["br"]; !ok {
+			out.Missing = append(out.Missing, "br")
+		}
+	} else if _, ok := in.Readings["cya"]; !ok {
 		out.Missing = append(out.Missing, "cya")
 	}
-	if len(out.Missing) > 0 {
+	out.Sequence, out.VisitMinutes = sequenceDoses(out.Doses)
+	if system == UnitsMetric && !in.baseUnits {
+		for i := range out.Doses {
+			out.Doses[i] = metricDose(out.Doses[i])
+		}
+		for i := range out.Sequence {
+			out.Sequence[i].Dose = metricDose(out.Sequence[i].Dose)
+		}
+		if out.Dilution != nil {
+			metricDilution(out.Dilution)
+		}
+		if out.TALowering != nil {
+			metricTALowering(out.TALowering)
+		}
+		if out.MaintenanceDose != nil {
+			*out.MaintenanceDose = metricDose(*out.MaintenanceDose)
+		}
+	}
+	if bodyProfile.Measures && !in.baseUnits {
+		measure := householdMeasure
+		if system == UnitsMetric {
+			measure = smallMetricDose
+		}
+		for i := range out.Doses {
+			out.Doses[i] = measure(out.Doses[i])
+		}
+		for i := range out.Sequence {
+			out.Sequence[i].Dose = measure(out.Sequence[i].Dose)
+		}
+		if out.MaintenanceDose != nil {
+			*out.MaintenanceDose = measure(*out.MaintenanceDose)
+		}
+	}
+	withPractical(out.Doses, system)
+	if out.MaintenanceDose != nil {
+		out.MaintenanceDose.Practical = practicalMeasure(*out.MaintenanceDose, system)
+	}
+	for i := range out.Sequence {
+		out.Sequence[i].Practical = practicalMeasure(out.Sequence[i].Dose, system)
+	}
+	if !in.baseUnits {
+		roundOutputDoses(&out)
+	}
+	out.Confidence = confidenceFor(len(out.Missing), len(out.Doses))
+	switch worstIssue(out.ReadingIssues) {
+	case IssueSevere:
 		out.Confidence = "Low"
+	case IssueWarning:
+		out.Confidence = lowerConfidence(out.Confidence)
+	}
+	if len(out.Doses) > 0 || out.MaintenanceDose != nil {
+		out.Cost = estimateCost(out.Doses, out.MaintenanceDose, in.Tenant)
+	}
+	if uncertainty := readingUncertainty(orig, &out); len(uncertainty) > 0 {
+		out.ReadingUncertainty = uncertainty
+		if len(out.Doses) > 0 {
+			out.DoseRanges = doseRanges(orig, uncertainty, out.Doses, &out)
+		}
 	}
 	return out
 }
 
+// roundOutputDoses rounds every reported dose once it is in its final unit.
+func roundOutputDoses(out *CalcOutput) {
+	if out.MaintenanceDose != nil {
+		*out.MaintenanceDose = roundDose(*out.MaintenanceDose)
+	}
+	for i := range out.Doses {
+		out.Doses[i] = roundDose(out.Doses[i])
+	}
+	for i := range out.Sequence {
+		out.Sequence[i].Dose = roundDose(out.Sequence[i].Dose)
+	}
+	if out.TALowering != nil {
+		for i := range out.TALowering.Cycles {
+			out.TALowering.Cycles[i].Acid = roundDose(out.TALowering.Cycles[i].Acid)
+		}
+	}
+}
+
+// phIncreaseProduct describes a base used to raise pH. OzPer10kPerPoint is
+// the dose that lifts 10k gallons by 0.1 pH at 100 ppm TA with no borates.
+type phIncreaseProduct struct {
+	Chemical         string
+	OzPer10kPerPoint float64
+	CapOz            float64
+	Notes            string
+}
+
+var phIncreaseProducts = map[string]phIncreaseProduct{
+	"soda_ash": {"sodium_carbonate", 3, 48, "Add half dose, circulate 30-60 min, retest before adding remainder. Also raises TA; broadcast slowly to avoid clouding."},
+	"borax":    {"sodium_tetraborate_decahydrate", 6.5, 96, "Add half dose, circulate 30-60 min, retest before adding remainder. Raises borates with little TA change."},
+}
+
+// phIncreaseDose sizes a pH-up addition. TA sets the buffer capacity and
+// borates add buffering near the target range, so both scale the dose up.
+func phIncreaseDose(in CalcInput, pool, delta float64) (Dose, []string) {
+	var assumptions []string
+	key := in.Products["phUp"]
+	product, ok := phIncreaseProducts[key]
+	if !ok {
+		if key != "" {
+			assumptions = append(assumptions, "Unknown phUp product "+strconv.Quote(key)+"; dosed as soda ash.")
+		}
+		product = phIncreaseProducts["soda_ash"]
+	}
+	ta, hasTA := in.Readings["ta"]
+	if !hasTA {
+		ta = in.ruleSet().DefaultTA
+		assumptions = append(assumptions, fmt.Sprintf("TA not provided; pH-up dose assumes %.0f ppm.", ta))
+	} else if ta < 60 {
+		assumptions = append(assumptions, "TA is below 60 ppm; raise TA with bicarbonate first or pH will drift back down.")
+	}
+	oz := capDose((delta/0.1)*product.OzPer10kPerPoint*(ta/100)*borateFactor(in.Readings)*(pool/10000), doseCap(in, pool, product.CapOz))
+	return Dose{product.Chemical, oz, "oz", product.Notes, ""}, assumptions
+}
+
+// autoFillTargets returns a copy of the targets with the missing ones filled
+// from the target profile: bromine and salt always, the other profile
+// readings when they fall outside its ranges, and FC from the FC/CYA
+// recommendation with AutoTargets.
+func autoFillTargets(in CalcInput, profile TargetProfile, out *CalcOutput) map[string]float64 {
+	targets := make(map[string]float64, len(in.Targets)+1)
+	for k, v := range in.Targets {
+		targets[k] = v
+	}
+	ranges := profile.Ranges
+	if isBromine(in.SanitizerType) {
+		if _, ok := targets["br"]; !ok {
+			br := ranges["br"]
+			targets["br"] = br.Target
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Bromine target set to %.0f ppm (range %.0f-%.0f).", br.Target, br.Min, br.Max))
+		}
+	} else if _, ok := targets["fc"]; !ok && in.AutoTargets {
+		rec, err := RecommendFCTargets(in.Readings, in.SanitizerType, in.IsSalt)
+		if err != nil {
+			out.Assumptions = append(out.Assumptions, "FC target not auto-filled: "+err.Error()+".")
+		} else {
+			targets["fc"] = rec.Target
+			out.Assumptions = append(out.Assumptions, rec.Rationale)
+		}
+	}
+	if _, ok := targets["salt"]; !ok && isSaltPool(in) {
+		spec := saltGeneratorSpec(in)
+		targets["salt"] = ranges["salt"].Target
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Salt target set to %.0f ppm, the middle of the generator's %.0f-%.0f ppm range.", targets["salt"], spec.IdealMin, spec.IdealMax))
+	}
+	for _, key := range profileFilledKeys {
+		rng, ok := ranges[key]
+		r, measured := in.Readings[key]
+		if _, set := targets[key]; set || !ok || !measured || (r >= rng.Min && r <= rng.Max) {
+			continue
+		}
+		targets[key] = rng.Target
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("%s %g is outside the %s range %g-%g; target set to %g.", readingLabels[key], r, profile.Name, rng.Min, rng.Max, rng.Target))
+	}
+	return targets
+}
+
+// targetAbove reports the target and reading for key when both are present
+// and the target is higher than the reading.
+func targetAbove(in CalcInput, key string) (float64, float64, bool) {
+	t, ok := in.Targets[key]
+	r, ok2 := in.Readings[key]
+	return t, r, ok && ok2 && t > r
+}
+
+// targetBelow is the mirror of targetAbove for chemicals that are dosed down.
+func targetBelow(in CalcInput, key string) (float64, float64, bool) {
+	t, ok := in.Targets[key]
+	r, ok2 := in.Readings[key]
+	return t, r, ok && ok2 && r > t
+}
+
+func confidenceFor(missing, doses int) string {
+	switch {
+	case missing > 0:
+		return "Low"
+	case doses >= 3:
+		return "High"
+	default:
+		return "Medium"
+	}
+}
+
+func capDose(v, max float64) float64 { return math.Min(math.Max(0, v), max) }
+
+// cappedDose caps v like capDose and, when the cap applies, adds the same
+// assumption lib/chemistry/dosing.ts reports.
+func cappedDose(v, max float64, chemical, unit string, assumptions *[]string) float64 {
+	if v > max {
+		*assumptions = append(*assumptions, fmt.Sprintf("%s capped at %g %s per addition; retest before dosing the remainder.", chemical, round(max), unit))
+	}
+	return capDose(v, max)
+}
+
 func round(v float64) float64 { return math.Round(v*10) / 10 }
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -1,6 +1,12 @@
 package services
 
-import "testing"
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestCalculateDosingNeedsVolume(t *testing.T) {
 	out := CalculateDosing(CalcInput{Readings: map[string]float64{"fc": 1}, Targets: map[string]float64{"fc": 4}})
@@ -19,3 +25,113 @@ func TestCalculateDosingChlorine(t *testing.T) {
 		t.Fatalf("expected at least one dose")
 	}
 }
+
+type goldenDosingCase struct {
+	Name     string    `json:"name"`
+	Input    CalcInput `json:"input"`
+	Expected struct {
+		Confidence  string   `json:"confidence"`
+		Doses       []Dose   `json:"doses"`
+		Assumptions []string `json:"assumptions"`
+		Missing     []string `json:"missingFields"`
+	} `json:"expected"`
+}
+
+// The same vectors are asserted by tests/chemistry.unit.test.ts so the Go and
+// TypeScript calculators cannot drift apart.
+func TestCalculateDosingGoldenVectors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/dosing_golden.json")
+	if err != nil {
+		t.Fatalf("read golden vectors: %v", err)
+	}
+	var cases []goldenDosingCase
+	if err := json.Unmarshal(raw, &cases); err != nil {
+		t.Fatalf("decode golden vectors: %v", err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := CalculateDosing(tc.Input)
+			if out.Confidence != tc.Expected.Confidence {
+				t.Fatalf("expected %s confidence, got %s", tc.Expected.Confidence, out.Confidence)
+			}
+			if strings.Join(out.Missing, ",") != strings.Join(tc.Expected.Missing, ",") {
+				t.Fatalf("expected missing %v, got %v", tc.Expected.Missing, out.Missing)
+			}
+			// Go appends its TA and dilution planning hints after the shared
+			// assumptions, so only the TypeScript prefix is compared.
+			if len(out.Assumptions) < len(tc.Expected.Assumptions) ||
+				strings.Join(out.Assumptions[:len(tc.Expected.Assumptions)], "\n") != strings.Join(tc.Expected.Assumptions, "\n") {
+				t.Fatalf("expected assumptions %q, got %q", tc.Expected.Assumptions, out.Assumptions)
+			}
+			if len(out.Doses) != len(tc.Expected.Doses) {
+				t.Fatalf("expected %d doses, got %+v", len(tc.Expected.Doses), out.Doses)
+			}
+			for i, want := range tc.Expected.Doses {
+				got := out.Doses[i]
+				if got.Chemical != want.Chemical || got.Unit != want.Unit || math.Abs(got.Amount-want.Amount) > 0.001 {
+					t.Fatalf("dose %d: expected %+v, got %+v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateDosingNotesMatchTypeScript(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"ph": 7.9, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.5},
+	})
+	if len(out.Doses) != 1 || !strings.Contains(out.Doses[0].Notes, "pre-dilute") {
+		t.Fatalf("expected acid dose with pre-dilute note, got %+v", out.Doses)
+	}
+	if len(out.SafetyNotes) != 2 || len(out.Assumptions) != 2 {
+		t.Fatalf("expected TypeScript safety notes and assumptions, got %+v %+v", out.SafetyNotes, out.Assumptions)
+	}
+}
+
+func TestCalculateDosingRaisesPHWithSodaAsh(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"ph": 7.0, "ta": 100, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.5},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "sodium_carbonate" {
+		t.Fatalf("expected a soda ash dose, got %+v", out.Doses)
+	}
+	if out.Doses[0].Amount != 15 {
+		t.Fatalf("expected 15 oz soda ash, got %v", out.Doses[0].Amount)
+	}
+	if !strings.Contains(out.Doses[0].Notes, "Add half") {
+		t.Fatalf("expected add-half note, got %q", out.Doses[0].Notes)
+	}
+}
+
+func TestCalculateDosingRaisesPHWithBoraxAndBorates(t *testing.T) {
+	in := CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"ph": 7.2, "ta": 80, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.4},
+		Products:          map[string]string{"phUp": "borax"},
+	}
+	plain := CalculateDosing(in)
+	in.Readings["borates"] = 50
+	buffered := CalculateDosing(in)
+	if plain.Doses[0].Chemical != "sodium_tetraborate_decahydrate" {
+		t.Fatalf("expected borax dose, got %+v", plain.Doses)
+	}
+	if buffered.Doses[0].Amount <= plain.Doses[0].Amount {
+		t.Fatalf("expected borates to increase dose: %v vs %v", buffered.Doses[0].Amount, plain.Doses[0].Amount)
+	}
+}
+
+func TestCalculateDosingCapsPHIncrease(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 40000,
+		Readings:          map[string]float64{"ph": 6.8, "ta": 120, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.6},
+	})
+	if out.Doses[0].Amount != 48 {
+		t.Fatalf("expected soda ash capped at 48 oz, got %v", out.Doses[0].Amount)
+	}
+}
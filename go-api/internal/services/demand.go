@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FCReading is one timestamped free chlorine test. A series of them with no
+// chlorine added in between shows how fast the pool uses chlorine.
+type FCReading struct {
+	TestedAt string  `json:"testedAt"`
+	FC       float64 `json:"fc"`
+}
+
+// OvernightLossTest is an overnight chlorine loss test (OCLT): FC measured
+// after sunset and again before sunrise, so sunlight plays no part and any
+// loss is organics or algae.
+type OvernightLossTest struct {
+	EveningFC float64 `json:"eveningFc"`
+	MorningFC float64 `json:"morningFc"`
+	Hours     float64 `json:"hours,omitempty"`
+}
+
+type ChlorineDemandInput struct {
+	FCHistory     []FCReading        `json:"fcHistory,omitempty"`
+	OvernightLoss *OvernightLossTest `json:"overnightLoss,omitempty"`
+}
+
+// ChlorineDemand is the estimated FC use in ppm per day. Status is "normal",
+// "elevated" or "organic_load".
+type ChlorineDemand struct {
+	DailyDemand   float64  `json:"dailyDemandPpm"`
+	OvernightLoss *float64 `json:"overnightLossPpm,omitempty"`
+	Status        string   `json:"status"`
+	Confidence    string   `json:"confidence"`
+	Findings      []string `json:"findings"`
+	Assumptions   []string `json:"assumptions"`
+	Missing       []string `json:"missingFields"`
+}
+
+const (
+	DemandNormal      = "normal"
+	DemandElevated    = "elevated"
+	DemandOrganicLoad = "organic_load"
+)
+
+// A sunny, stabilized pool typically uses 1-3 ppm a day. Well beyond that,
+// something other than sunlight is consuming chlorine.
+const (
+	normalDailyDemand  = 3
+	organicDailyDemand = 6
+	// minDemandHours is the shortest series worth extrapolating to a day.
+	minDemandHours        = 6
+	defaultOvernightHours = 10
+	fcTestNoise           = 0.2
+)
+
+// EstimateChlorineDemand estimates daily FC demand from an FC series, an
+// overnight loss test, or both. The series gives the daily figure; the OCLT
+// decides whether the loss is organic. Intervals where FC rose (chlorine was
+// added) are left out.
+func EstimateChlorineDemand(in ChlorineDemandInput) ChlorineDemand {
+	out := ChlorineDemand{Status: DemandNormal, Confidence: "Medium", Findings: []string{}, Assumptions: []string{}, Missing: []string{}}
+	seriesHours, seriesLoss := 0.0, 0.0
+	if len(in.FCHistory) > 0 {
+		seriesHours, seriesLoss = fcSeriesLoss(in.FCHistory, &out)
+		if seriesHours < minDemandHours {
+			out.Missing = append(out.Missing, "fcHistory")
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("FC history covers %.1f h of falling readings; at least %d h is needed to estimate daily demand.", seriesHours, minDemandHours))
+			seriesHours = 0
+		}
+	}
+	if seriesHours > 0 {
+		out.DailyDemand = round(seriesLoss / seriesHours * 24)
+		out.Findings = append(out.Findings, fmt.Sprintf("FC fell %.1f ppm over %.1f h: about %.1f ppm per day.", seriesLoss, seriesHours, out.DailyDemand))
+		if seriesHours >= 24 {
+			out.Confidence = "High"
+		} else {
+			out.Assumptions = append(out.Assumptions, "FC history covers less than a day; daytime and overnight losses differ, so the daily figure is extrapolated.")
+		}
+	}
+
+	if t := in.OvernightLoss; t != nil {
+		loss := t.EveningFC - t.MorningFC
+		hours := t.Hours
+		if hours <= 0 {
+			hours = defaultOvernightHours
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Overnight test length not provided; assumed %d h.", defaultOvernightHours))
+		}
+		if loss < 0 {
+			out.Assumptions = append(out.Assumptions, "Overnight FC rose; the test is invalid if chlorine was added or a generator ran overnight.")
+			loss = 0
+		}
+		loss = round(loss)
+		out.OvernightLoss = &loss
+		if loss > shockExitMaxOCLT {
+			out.Status = DemandOrganicLoad
+			out.Findings = append(out.Findings, fmt.Sprintf("Overnight loss of %.1f ppm fails the OCLT (more than %.0f ppm): organics or algae are consuming chlorine.", loss, shockExitMaxOCLT))
+		} else {
+			out.Findings = append(out.Findings, fmt.Sprintf("Overnight loss of %.1f ppm passes the OCLT; no significant organic load.", loss))
+		}
+		if seriesHours == 0 {
+			// Without sunlight the overnight rate is a floor for the day.
+			out.DailyDemand = round(loss / hours * 24)
+			out.Assumptions = append(out.Assumptions, "Daily demand extrapolated from the overnight rate excludes sunlight loss; daytime demand is higher.")
+		}
+	}
+
+	switch {
+	case len(in.FCHistory) == 0 && in.OvernightLoss == nil:
+		out.Missing = append(out.Missing, "fcHistory", "overnightLoss")
+		out.Confidence = "Low"
+	case out.Status == DemandOrganicLoad:
+	case out.DailyDemand > organicDailyDemand:
+		out.Status = DemandOrganicLoad
+		out.Findings = append(out.Findings, fmt.Sprintf("Demand above %d ppm per day points to organic load or early algae; run an overnight loss test to confirm.", organicDailyDemand))
+	case out.DailyDemand > normalDailyDemand:
+		out.Status = DemandElevated
+		out.Findings = append(out.Findings, fmt.Sprintf("Demand above %d ppm per day; check CYA, bather load and for early algae.", normalDailyDemand))
+	}
+	if len(out.Missing) > 0 {
+		out.Confidence = "Low"
+	}
+	return out
+}
+
+// fcSeriesLoss sums the FC drop and elapsed hours across consecutive
+// readings, skipping intervals where FC rose.
+func fcSeriesLoss(history []FCReading, out *ChlorineDemand) (float64, float64) {
+	type reading struct {
+		at time.Time
+		fc float64
+	}
+	var series []reading
+	for i, r := range history {
+		at, err := time.Parse(time.RFC3339, r.TestedAt)
+		if err != nil {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("fcHistory[%d] testedAt %q is not RFC3339; skipped.", i, r.TestedAt))
+			continue
+		}
+		series = append(series, reading{at, r.FC})
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].at.Before(series[j].at) })
+	hours, loss := 0.0, 0.0
+	skipped := 0
+	for i := 1; i < len(series); i++ {
+		drop := series[i-1].fc - series[i].fc
+		if drop < -fcTestNoise {
+			skipped++
+			continue
+		}
+		hours += series[i].at.Sub(series[i-1].at).Hours()
+		loss += max(drop, 0)
+	}
+	if skipped > 0 {
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("FC rose across %d interval(s), so chlorine was added; those intervals are left out.", skipped))
+	}
+	return hours, loss
+}
+
+// maintenanceChlorine is the daily chlorine that replaces in.DailyFCDemand.
+func maintenanceChlorine(in CalcInput, pool float64, out *CalcOutput) *Dose {
+	dose, assumptions, warnings := chlorineDose(in, pool, in.DailyFCDemand)
+	out.Assumptions = append(out.Assumptions, assumptions...)
+	out.Warnings = append(out.Warnings, warnings...)
+	dose.Notes = fmt.Sprintf("Daily maintenance for %.1f ppm of demand; add in the evening so sunlight does not burn it off first.", in.DailyFCDemand)
+	return &dose
+}
+
+// demandFallback turns a chlorine demand estimate into a diagnosis and
+// steps. Organic load overrides the sanitizer diagnosis; normal demand with
+// low FC means the pool is simply under-dosed.
+func demandFallback(context *DiagnoseContext) (string, []string) {
+	if context == nil || (len(context.FCHistory) == 0 && context.OvernightLoss == nil) {
+		return "", nil
+	}
+	demand := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: context.FCHistory, OvernightLoss: context.OvernightLoss})
+	if demand.DailyDemand == 0 && demand.OvernightLoss == nil {
+		return "", nil
+	}
+	steps := append([]string{}, demand.Findings...)
+	switch demand.Status {
+	case DemandOrganicLoad:
+		steps = append(steps,
+			"Raise FC to shock level for the CYA and hold it until the overnight loss test drops 1 ppm or less",
+			"Brush walls and floor daily and vacuum debris while holding shock level",
+		)
+		return fmt.Sprintf("Chlorine demand of about %.1f ppm per day indicates organic load or early algae consuming chlorine.", demand.DailyDemand), steps
+	case DemandElevated:
+		return fmt.Sprintf("Chlorine demand is elevated at about %.1f ppm per day.", demand.DailyDemand), steps
+	}
+	if context.PoolVolumeGallons != nil && demand.DailyDemand > 0 {
+		d := fallbackMaintenanceDose(context, demand.DailyDemand)
+		steps = append(steps, fmt.Sprintf("Demand is normal; keep up with about %g %s of %s (or equivalent generator output) each day", d.Amount, d.Unit, liquidChlorineName(d.Chemical)))
+	}
+	return "", steps
+}
+
+// liquidChlorineName turns "liquid_chlorine_10pct" into "10% liquid chlorine"
+// for prose.
+func liquidChlorineName(chemical string) string {
+	if m := strengthSuffix.FindStringSubmatch(chemical); m != nil {
+		return m[1] + "% liquid chlorine"
+	}
+	return "liquid chlorine"
+}
+
+// fallbackMaintenanceDose sizes the daily chlorine the way the calculator
+// reports it: the tenant's rule-set strength, the caller's units and, for
+// spas, household measures.
+func fallbackMaintenanceDose(context *DiagnoseContext, daily float64) Dose {
+	rules, _ := resolveRuleSet("", context.Tenant)
+	body, _ := resolveBodyOfWater(context.BodyOfWater)
+	system, _ := resolveUnitSystem(context.UnitSystem)
+	d, _, _ := chlorineDose(CalcInput{BodyOfWater: body, rules: &rules}, *context.PoolVolumeGallons, daily)
+	if system == UnitsMetric {
+		d = metricDose(d)
+	}
+	if waterBodyProfiles[body].Measures {
+		if system == UnitsMetric {
+			d = smallMetricDose(d)
+		} else {
+			d = householdMeasure(d)
+		}
+	}
+	return roundDose(d)
+}
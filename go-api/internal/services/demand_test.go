@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEstimateChlorineDemandFromSeries(t *testing.T) {
+	out := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: []FCReading{
+		{"2026-06-02T08:00:00Z", 5},
+		{"2026-06-01T08:00:00Z", 7},
+		{"2026-06-02T18:00:00Z", 8},
+		{"2026-06-03T08:00:00Z", 6.5},
+		{"yesterday", 9},
+	}})
+	// 2 ppm over 24 h, then chlorine added, then 1.5 ppm over 14 h.
+	if out.DailyDemand != 2.2 || out.Status != DemandNormal || out.Confidence != "High" {
+		t.Fatalf("unexpected demand: %+v", out)
+	}
+	assumptions := strings.Join(out.Assumptions, " ")
+	if !strings.Contains(assumptions, "not RFC3339") || !strings.Contains(assumptions, "FC rose across 1 interval") {
+		t.Fatalf("expected skipped reading and interval, got %v", out.Assumptions)
+	}
+}
+
+func TestEstimateChlorineDemandStatus(t *testing.T) {
+	high := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: []FCReading{{"2026-06-01T08:00:00Z", 10}, {"2026-06-01T20:00:00Z", 6}}})
+	if high.DailyDemand != 8 || high.Status != DemandOrganicLoad || high.Confidence != "Medium" {
+		t.Fatalf("expected 8 ppm/day to flag organic load, got %+v", high)
+	}
+	passed := EstimateChlorineDemand(ChlorineDemandInput{
+		FCHistory:     []FCReading{{"2026-06-01T08:00:00Z", 8}, {"2026-06-01T20:00:00Z", 6}},
+		OvernightLoss: &OvernightLossTest{EveningFC: 6, MorningFC: 5.5, Hours: 10},
+	})
+	if passed.Status != DemandElevated || *passed.OvernightLoss != 0.5 || passed.DailyDemand != 4 {
+		t.Fatalf("expected passing OCLT with elevated daytime demand, got %+v", passed)
+	}
+	short := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: []FCReading{{"2026-06-01T08:00:00Z", 8}, {"2026-06-01T10:00:00Z", 7}}})
+	if short.DailyDemand != 0 || short.Confidence != "Low" || short.Missing[0] != "fcHistory" {
+		t.Fatalf("expected too-short series to be rejected, got %+v", short)
+	}
+	none := EstimateChlorineDemand(ChlorineDemandInput{})
+	if len(none.Missing) != 2 {
+		t.Fatalf("expected both inputs missing, got %+v", none)
+	}
+}
+
+func TestCalculateDosingMaintenanceFromHistory(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 4, "cya": 40},
+		Targets:           map[string]float64{"fc": 4},
+		FCHistory:         []FCReading{{"2026-06-01T08:00:00Z", 6}, {"2026-06-02T08:00:00Z", 3.5}},
+	})
+	if out.ChlorineDemand == nil || out.ChlorineDemand.DailyDemand != 2.5 {
+		t.Fatalf("expected demand estimate, got %+v", out.ChlorineDemand)
+	}
+	// 2.5 ppm in 20k gallons of 10% liquid chlorine.
+	if d := out.MaintenanceDose; d == nil || d.Chemical != "liquid_chlorine_10pct" || d.Amount != 64 || d.Practical != "half a jug (1 gal)" {
+		t.Fatalf("unexpected maintenance dose: %+v", out.MaintenanceDose)
+	}
+	if len(out.Doses) != 0 {
+		t.Fatalf("expected maintenance kept out of this visit's doses, got %+v", out.Doses)
+	}
+}
+
+func TestCalculateDosingSaltOutputFromOvernightLoss(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		IsSalt:            true,
+		Readings:          map[string]float64{"fc": 4, "cya": 70, "salt": 3200},
+		Targets:           map[string]float64{"fc": 4},
+		SaltGenerator:     &SaltGenerator{RatedLbPerDay: 2, PumpHours: 12},
+		OvernightLoss:     &OvernightLossTest{EveningFC: 6, MorningFC: 3},
+	})
+	if out.MaintenanceDose != nil || out.SaltGenerator.OutputPercent == nil {
+		t.Fatalf("expected generator output instead of a chlorine dose, got %+v %+v", out.MaintenanceDose, out.SaltGenerator)
+	}
+	if len(out.Warnings) == 0 || !strings.Contains(strings.Join(out.Warnings, " "), "organic load") {
+		t.Fatalf("expected organic load warning, got %v", out.Warnings)
+	}
+}
+
+func TestBuildFallbackPlanUsesDemand(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("", &DiagnoseContext{OvernightLoss: &OvernightLossTest{EveningFC: 9, MorningFC: 6, Hours: 10}})
+	if !strings.Contains(plan.Diagnosis, "organic load or early algae") || plan.Confidence != "Medium" {
+		t.Fatalf("expected organic load diagnosis, got %+v", plan)
+	}
+	if !strings.Contains(strings.Join(plan.Steps, " | "), "fails the OCLT") {
+		t.Fatalf("expected OCLT finding in steps, got %v", plan.Steps)
+	}
+
+	gallons := 10000.0
+	fc := 1.0
+	plan = BuildFallbackPlanWithContext("cloudy", &DiagnoseContext{
+		PoolVolumeGallons: &gallons,
+		LatestTest:        &DiagnoseWaterTest{FC: &fc},
+		FCHistory:         []FCReading{{"2026-06-01T08:00:00Z", 3}, {"2026-06-02T08:00:00Z", 1}},
+	})
+	if !strings.Contains(plan.Diagnosis, "low sanitizer") || !strings.Contains(strings.Join(plan.Steps, " | "), "about 25.6 oz of 10% liquid chlorine") {
+		t.Fatalf("expected under-dosing steps with normal demand, got %+v", plan)
+	}
+}
+
+func TestBuildFallbackPlanDemandMetric(t *testing.T) {
+	liters := 40000.0
+	plan := BuildFallbackPlanWithContext("", &DiagnoseContext{
+		UnitSystem:       UnitsMetric,
+		PoolVolumeLiters: &liters,
+		FCHistory:        []FCReading{{"2026-06-01T08:00:00Z", 3}, {"2026-06-02T08:00:00Z", 1}},
+	})
+	want := CalculateDosing(CalcInput{
+		UnitSystem:       UnitsMetric,
+		PoolVolumeLiters: liters,
+		Readings:         map[string]float64{"fc": 1, "cya": 30},
+		Targets:          map[string]float64{"fc": 3},
+	}).Doses[0]
+	step := fmt.Sprintf("about %g ml of 10%% liquid chlorine", want.Amount)
+	if want.Unit != "ml" || !strings.Contains(strings.Join(plan.Steps, " | "), step) {
+		t.Fatalf("expected %q matching the calculator, got %v", step, plan.Steps)
+	}
+}
+
+func TestBuildFallbackPlanDemandUsesTenantStrength(t *testing.T) {
+	data, err := os.ReadFile("../../rules/dosing-rules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestRuleSets(t, string(data)); err != nil {
+		t.Fatal(err)
+	}
+	gallons := 10000.0
+	plan := BuildFallbackPlanWithContext("", &DiagnoseContext{
+		Tenant:            "acme-pools",
+		PoolVolumeGallons: &gallons,
+		FCHistory:         []FCReading{{"2026-06-01T08:00:00Z", 3}, {"2026-06-02T08:00:00Z", 1}},
+	})
+	if !strings.Contains(strings.Join(plan.Steps, " | "), "about 32 oz of 8% liquid chlorine") {
+		t.Fatalf("expected the tenant's 8%% chlorine, got %v", plan.Steps)
+	}
+}
+
+func TestValidateDiagnoseRequestAcceptsFCHistory(t *testing.T) {
+	err := ValidateDiagnoseRequest(DiagnoseRequest{PoolID: "p1", Context: &DiagnoseContext{FCHistory: []FCReading{{"2026-06-01T08:00:00Z", 3}}}})
+	if err != nil {
+		t.Fatalf("expected FC history alone to be accepted, got %v", err)
+	}
+}
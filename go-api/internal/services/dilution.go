@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DilutionOptions switches the calculator into drain-and-refill mode for
+// targets below the current reading. MaxDrainPercent is the most that can
+// safely come out in one cycle (vinyl liners and high water tables often
+// limit this).
+type DilutionOptions struct {
+	FillWater       map[string]float64 `json:"fillWater"`
+	MaxDrainPercent float64            `json:"maxDrainPercent,omitempty"`
+}
+
+type DilutionCycle struct {
+	Cycle        int                `json:"cycle"`
+	DrainPercent float64            `json:"drainPercent"`
+	DrainVolume  float64            `json:"drainVolume"`
+	Predicted    map[string]float64 `json:"predicted"`
+}
+
+// DilutionPlan totals are summed over every cycle: TotalDrainPercent is the
+// share of the pool's volume replaced, which exceeds 100 when cycles repeat.
+type DilutionPlan struct {
+	Limiting          string             `json:"limiting"`
+	TotalDrainPercent float64            `json:"totalDrainPercent"`
+	TotalDrainVolume  float64            `json:"totalDrainVolume"`
+	VolumeUnit        string             `json:"volumeUnit"`
+	Cycles            []DilutionCycle    `json:"cycles"`
+	Predicted         map[string]float64 `json:"predicted"`
+	Notes             []string           `json:"notes"`
+}
+
+const (
+	defaultMaxDrainPercent = 50
+	maxDilutionCycles      = 10
+)
+
+// dilutableKeys can only be lowered by replacing water. Fill water is assumed
+// free of CYA, salt and borates, but tap CH and TDS vary too much to guess.
+var dilutableKeys = []string{"ch", "cya", "salt", "tds", "borates"}
+
+var fillWaterRequired = map[string]bool{"ch": true, "tds": true}
+
+// carriedKeys are diluted alongside the limiting parameter and reported in
+// the predictions; pH is not linear under mixing and is left out.
+var carriedKeys = []string{"fc", "ta", "ch", "cya", "salt", "tds", "borates"}
+
+// planDilution sizes the drain needed to bring every dilutable reading down
+// to its target. Each cycle removes at most the configured fraction, so a
+// pool limited to 30% per cycle may need several cycles.
+func planDilution(in CalcInput, pool float64, out *CalcOutput) *DilutionPlan {
+	opts := in.Dilution
+	fill := func(key string) float64 { return opts.FillWater[key] }
+	fraction := 0.0
+	limiting := ""
+	var notes []string
+	for _, key := range dilutableKeys {
+		t, r, ok := targetBelow(in, key)
+		if !ok {
+			continue
+		}
+		if _, has := opts.FillWater[key]; !has && fillWaterRequired[key] {
+			out.Missing = append(out.Missing, "dilution.fillWater."+key)
+			continue
+		}
+		if fill(key) >= t {
+			notes = append(notes, fmt.Sprintf("Fill water %s (%.0f) is at or above the %.0f target; dilution cannot reach it.", key, fill(key), t))
+			continue
+		}
+		if f := (r - t) / (r - fill(key)); f > fraction {
+			fraction, limiting = f, key
+		}
+	}
+	if limiting == "" {
+		if len(notes) == 0 {
+			return nil
+		}
+		return &DilutionPlan{Cycles: []DilutionCycle{}, Predicted: map[string]float64{}, Notes: notes}
+	}
+
+	maxDrain := opts.MaxDrainPercent
+	if maxDrain <= 0 {
+		maxDrain = defaultMaxDrainPercent
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Max drain per cycle not provided; limited to %d%%.", defaultMaxDrainPercent))
+	}
+	perCycle := math.Min(maxDrain, 100) / 100
+
+	current := make(map[string]float64)
+	for _, key := range carriedKeys {
+		if v, ok := in.Readings[key]; ok {
+			current[key] = v
+		}
+	}
+	plan := &DilutionPlan{Limiting: limiting, Cycles: []DilutionCycle{}, Notes: notes}
+	target := in.Targets[limiting]
+	for cycle := 1; current[limiting] > target+1e-9; cycle++ {
+		if cycle > maxDilutionCycles {
+			plan.Notes = append(plan.Notes, fmt.Sprintf("Target not reached after %d cycles; consider a larger drain or a reverse osmosis service.", maxDilutionCycles))
+			break
+		}
+		f := math.Min(perCycle, (current[limiting]-target)/(current[limiting]-fill(limiting)))
+		for key, v := range current {
+			current[key] = v*(1-f) + fill(key)*f
+		}
+		plan.Cycles = append(plan.Cycles, DilutionCycle{
+			Cycle:        cycle,
+			DrainPercent: round(f * 100),
+			DrainVolume:  math.Round(f * pool),
+			Predicted:    roundedReadings(current),
+		})
+		plan.TotalDrainVolume += f * pool
+	}
+	plan.TotalDrainPercent = round(plan.TotalDrainVolume / pool * 100)
+	plan.TotalDrainVolume = math.Round(plan.TotalDrainVolume)
+	plan.VolumeUnit = "gallons"
+	plan.Predicted = roundedReadings(current)
+	if len(plan.Cycles) > 1 {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("Drain no more than %.0f%% per cycle; refill fully and circulate before the next cycle.", perCycle*100))
+	}
+	plan.Notes = append(plan.Notes, "Retest and rebalance TA, pH and FC after the final refill.")
+	return plan
+}
+
+// dilutionNeeded notes readings that only a drain can lower when the caller
+// has not asked for a dilution plan.
+func dilutionNeeded(in CalcInput, out *CalcOutput) {
+	var keys []string
+	for _, key := range dilutableKeys {
+		if _, _, ok := targetBelow(in, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Dilution needed: %s above target and only drain-and-refill lowers it; set dilution to plan the drain.", strings.Join(keys, ", ")))
+	}
+}
+
+// metricDilution reports drain volumes in liters.
+func metricDilution(plan *DilutionPlan) {
+	plan.TotalDrainVolume = math.Round(gallonsToLiters(plan.TotalDrainVolume))
+	plan.VolumeUnit = "liters"
+	for i := range plan.Cycles {
+		plan.Cycles[i].DrainVolume = math.Round(gallonsToLiters(plan.Cycles[i].DrainVolume))
+	}
+}
+
+// roundedReadings rounds for display; pH keeps two decimals.
+func roundedReadings(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		if k == "ph" {
+			out[k] = round2(v)
+		} else {
+			out[k] = round(v)
+		}
+	}
+	return out
+}
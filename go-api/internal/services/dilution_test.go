@@ -0,0 +1,90 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingDilutionSingleDrain(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 4, "ta": 100, "ch": 600, "cya": 100},
+		Targets:           map[string]float64{"ch": 450, "cya": 60},
+		Dilution:          &DilutionOptions{FillWater: map[string]float64{"ch": 100, "ta": 50}, MaxDrainPercent: 60},
+	})
+	plan := out.Dilution
+	if plan == nil || plan.Limiting != "cya" || plan.TotalDrainPercent != 40 {
+		t.Fatalf("expected a 40%% drain limited by cya, got %+v", plan)
+	}
+	if len(plan.Cycles) != 1 || plan.TotalDrainVolume != 8000 || plan.VolumeUnit != "gallons" {
+		t.Fatalf("expected one 8000 gallon cycle, got %+v", plan)
+	}
+	if plan.Predicted["cya"] != 60 || plan.Predicted["ch"] != 400 || plan.Predicted["ta"] != 80 {
+		t.Fatalf("unexpected predictions: %v", plan.Predicted)
+	}
+}
+
+func TestCalculateDosingDilutionMultipleCycles(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"cya": 120},
+		Targets:           map[string]float64{"cya": 50},
+		Dilution:          &DilutionOptions{MaxDrainPercent: 30},
+	})
+	plan := out.Dilution
+	if len(plan.Cycles) != 3 {
+		t.Fatalf("expected 3 cycles at 30%%, got %+v", plan.Cycles)
+	}
+	if plan.Cycles[0].DrainPercent != 30 || plan.Cycles[2].DrainPercent >= 30 {
+		t.Fatalf("expected capped cycles with a smaller final drain, got %+v", plan.Cycles)
+	}
+	if plan.Predicted["cya"] != 50 {
+		t.Fatalf("expected cya to reach 50, got %v", plan.Predicted["cya"])
+	}
+	sum := 0.0
+	for _, c := range plan.Cycles {
+		sum += c.DrainVolume
+	}
+	if math.Abs(plan.TotalDrainVolume-sum) > 1 || math.Abs(plan.TotalDrainPercent-sum/150) > 0.1 {
+		t.Fatalf("expected totals to sum the cycles (%v gallons), got %+v", sum, plan)
+	}
+	if plan.TotalDrainPercent <= 100*70.0/120 {
+		t.Fatalf("expected cycled drains to replace more water than one drain, got %v%%", plan.TotalDrainPercent)
+	}
+}
+
+func TestCalculateDosingDilutionFillWaterLimits(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"ch": 500, "cya": 40},
+		Targets:           map[string]float64{"ch": 250},
+		Dilution:          &DilutionOptions{FillWater: map[string]float64{"ch": 300}},
+	})
+	if out.Dilution == nil || out.Dilution.Limiting != "" || !strings.Contains(out.Dilution.Notes[0], "cannot reach") {
+		t.Fatalf("expected unreachable-target note, got %+v", out.Dilution)
+	}
+}
+
+func TestCalculateDosingDilutionNeedsFillCH(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"ch": 500, "cya": 40},
+		Targets:           map[string]float64{"ch": 300},
+		Dilution:          &DilutionOptions{},
+	})
+	if out.Confidence != "Low" || out.Missing[0] != "dilution.fillWater.ch" {
+		t.Fatalf("expected missing fill CH, got %s %v", out.Confidence, out.Missing)
+	}
+}
+
+func TestCalculateDosingDilutionNeededWithoutPlan(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"fc": 4, "ch": 600, "cya": 100, "salt": 3800},
+		Targets:           map[string]float64{"ch": 400, "cya": 50, "salt": 3200},
+	})
+	if out.Dilution != nil || !strings.Contains(strings.Join(out.Assumptions, " "), "Dilution needed: ch, cya, salt") {
+		t.Fatalf("expected a dilution-needed note for ch, cya and salt, got %v", out.Assumptions)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,6 +21,7 @@ type DiagnosePlan struct {
 	SafetyNotes       []string            `json:"safety_notes"`
 	RetestInHours     int                 `json:"retest_in_hours"`
 	WhenToCallPro     []string            `json:"when_to_call_pro"`
+	EstimatedCost     *CostEstimate       `json:"estimated_cost,omitempty"`
 }
 
 type DiagnoseRequest struct {
@@ -28,23 +31,38 @@ type DiagnoseRequest struct {
 }
 
 type DiagnoseContext struct {
+	UnitSystem        string             `json:"unitSystem,omitempty"`
+	Tenant            string             `json:"tenant,omitempty"`
 	PoolVolumeGallons *float64           `json:"poolVolumeGallons,omitempty"`
+	PoolVolumeLiters  *float64           `json:"poolVolumeLiters,omitempty"`
+	BodyOfWater       string             `json:"bodyOfWater,omitempty"`
 	SurfaceType       string             `json:"surfaceType,omitempty"`
 	SanitizerType     string             `json:"sanitizerType,omitempty"`
 	IsSalt            *bool              `json:"isSalt,omitempty"`
 	LatestTest        *DiagnoseWaterTest `json:"latestTest,omitempty"`
+	FCHistory         []FCReading        `json:"fcHistory,omitempty"`
+	OvernightLoss     *OvernightLossTest `json:"overnightLoss,omitempty"`
 }
 
 type DiagnoseWaterTest struct {
 	TestedAt string   `json:"testedAt,omitempty"`
 	FC       *float64 `json:"fc,omitempty"`
 	CC       *float64 `json:"cc,omitempty"`
+	TC       *float64 `json:"tc,omitempty"`
 	PH       *float64 `json:"ph,omitempty"`
 	TA       *float64 `json:"ta,omitempty"`
 	CH       *float64 `json:"ch,omitempty"`
 	CYA      *float64 `json:"cya,omitempty"`
 	Salt     *float64 `json:"salt,omitempty"`
 	TempF    *float64 `json:"tempF,omitempty"`
+	TempC    *float64 `json:"tempC,omitempty"`
+	Borates  *float64 `json:"borates,omitempty"`
+	TDS      *float64 `json:"tds,omitempty"`
+	Bromine  *float64 `json:"bromine,omitempty"`
+	// Phosphates is in ppb.
+	Phosphates *float64 `json:"phosphates,omitempty"`
+	Iron       *float64 `json:"iron,omitempty"`
+	Copper     *float64 `json:"copper,omitempty"`
 }
 
 type openAIChatCompletionRequest struct {
@@ -90,6 +108,21 @@ func BuildFallbackPlan(symptoms string) DiagnosePlan {
 }
 
 func BuildFallbackPlanWithContext(symptoms string, context *DiagnoseContext) DiagnosePlan {
+	context = normalizeDiagnoseContext(context)
+	body := BodyPool
+	var bodySteps []string
+	if context != nil {
+		body, _ = resolveBodyOfWater(context.BodyOfWater)
+		if context.PoolVolumeGallons == nil && body != BodyPool {
+			gallons := waterBodyProfiles[body].DefaultGallons
+			context.PoolVolumeGallons = &gallons
+			if system, _ := resolveUnitSystem(context.UnitSystem); system == UnitsMetric {
+				bodySteps = append(bodySteps, fmt.Sprintf("Volume not provided; amounts assume %.0f liters", math.Round(gallonsToLiters(gallons))))
+			} else {
+				bodySteps = append(bodySteps, fmt.Sprintf("Volume not provided; amounts assume %.0f gallons", gallons))
+			}
+		}
+	}
 	confidence := "Low"
 	diagnosis := "Likely sanitizer imbalance or filtration issue."
 	steps := []string{
@@ -103,14 +136,25 @@ func BuildFallbackPlanWithContext(symptoms string, context *DiagnoseContext) Dia
 		"unit":         "oz",
 		"instructions": "Add half now, retest in 4 hours.",
 	}
-	retestHours := 4
+	retestHours := waterBodyProfiles[body].RetestHours
 
 	if strings.TrimSpace(symptoms) != "" {
 		confidence = "Medium"
 	}
 
+	bromine := context != nil && isBromine(context.SanitizerType)
+	if bromine {
+		diagnosis, steps, chemicalAddition = bromineFallback(context)
+	}
+
+	metalDiagnosis, metalSteps, metalAddition, metals := metalsFallback(symptoms, context)
+	if metals {
+		diagnosis, steps, chemicalAddition = metalDiagnosis, metalSteps, metalAddition
+		confidence = "Medium"
+	}
+
 	if context != nil && context.LatestTest != nil {
-		if context.LatestTest.FC != nil && *context.LatestTest.FC < 2 {
+		if !bromine && !metals && context.LatestTest.FC != nil && *context.LatestTest.FC < 2 {
 			diagnosis = "Likely low sanitizer with early algae/organics load."
 			steps = []string{
 				"Clean and backwash/clean filter",
@@ -122,26 +166,96 @@ func BuildFallbackPlanWithContext(symptoms string, context *DiagnoseContext) Dia
 		if context.LatestTest.PH != nil && *context.LatestTest.PH > 7.8 {
 			steps = append([]string{"Lower pH gradually before additional oxidizer additions if needed"}, steps...)
 		}
-		if context.LatestTest.CC != nil && *context.LatestTest.CC >= 0.5 {
+		if !bromine && !metals && context.LatestTest.CC != nil && *context.LatestTest.CC >= 0.5 {
 			steps = append(steps, "Treat combined chlorine with conservative oxidation and retest")
 		}
+		if context.LatestTest.Borates != nil && *context.LatestTest.Borates > borateUnsafe {
+			steps = append(steps, fmt.Sprintf("Borates are %.0f ppm, above the %d ppm safe limit; partially drain and refill", *context.LatestTest.Borates, borateUnsafe))
+		}
+		if sat := CalculateSaturation(SaturationInput{Test: *context.LatestTest, SurfaceType: context.SurfaceType}); len(sat.Missing) == 0 && sat.Status != "balanced" {
+			steps = append(steps, fmt.Sprintf("Water is %s (CSI %.2f): %s", sat.Status, sat.CSI, sat.Suggestions[0]))
+		}
 	}
 
-	if context != nil && context.PoolVolumeGallons != nil && *context.PoolVolumeGallons > 25000 {
-		chemicalAddition["amount"] = "96"
-	} else if context != nil && context.PoolVolumeGallons != nil && *context.PoolVolumeGallons < 10000 {
-		chemicalAddition["amount"] = "40"
+	if !bromine && !metals {
+		demandDiagnosis, demandSteps := demandFallback(context)
+		if demandDiagnosis != "" {
+			diagnosis = demandDiagnosis
+			confidence = "Medium"
+		}
+		steps = append(steps, demandSteps...)
+	}
+
+	if phosphateSteps := phosphateFallbackSteps(symptoms, context); len(phosphateSteps) > 0 {
+		diagnosis += " Phosphates may be feeding recurring algae."
+		steps = append(steps, phosphateSteps...)
+	}
+
+	if saltSteps := saltCellFallbackSteps(symptoms, context); len(saltSteps) > 0 {
+		diagnosis += " Salt generator output or cell condition may be a factor."
+		steps = append(steps, saltSteps...)
 	}
 
-	return DiagnosePlan{
+	if body != BodyPool {
+		// The sequestrant is already sized for the volume.
+		sized := chemicalAddition
+		if metals {
+			sized = nil
+		}
+		steps = append(steps, bodySteps...)
+		steps = append(steps, waterBodyFallback(body, context, sized, bromine)...)
+	} else if !bromine && !metals && context != nil && context.PoolVolumeGallons != nil {
+		if *context.PoolVolumeGallons > 25000 {
+			chemicalAddition["amount"] = "96"
+		} else if *context.PoolVolumeGallons < 10000 {
+			chemicalAddition["amount"] = "40"
+		}
+	}
+	if context != nil && chemicalAddition != nil {
+		oz, _ := strconv.ParseFloat(chemicalAddition["amount"], 64)
+		system, _ := resolveUnitSystem(context.UnitSystem)
+		if practical := practicalMeasure(Dose{chemicalAddition["chemical"], oz, chemicalAddition["unit"], "", ""}, system); practical != "" {
+			chemicalAddition["practical"] = practical
+		}
+		d := Dose{chemicalAddition["chemical"], oz, chemicalAddition["unit"], "", ""}
+		measures := waterBodyProfiles[body].Measures
+		switch {
+		case system == UnitsMetric && measures:
+			d = roundDose(smallMetricDose(metricDose(d)))
+			chemicalAddition["amount"] = fmt.Sprintf("%g", d.Amount)
+			chemicalAddition["unit"] = d.Unit
+		case system == UnitsMetric:
+			d = metricDose(d)
+			chemicalAddition["amount"] = fmt.Sprintf("%.0f", d.Amount)
+			chemicalAddition["unit"] = d.Unit
+		case measures:
+			d = roundDose(householdMeasure(d))
+			chemicalAddition["amount"] = fmt.Sprintf("%g", d.Amount)
+			chemicalAddition["unit"] = d.Unit
+		}
+	}
+
+	chemicalAdditions := []map[string]string{}
+	if chemicalAddition != nil {
+		chemicalAdditions = append(chemicalAdditions, chemicalAddition)
+	}
+
+	plan := DiagnosePlan{
 		Diagnosis:         diagnosis,
 		Confidence:        confidence,
 		Steps:             steps,
-		ChemicalAdditions: []map[string]string{chemicalAddition},
+		ChemicalAdditions: chemicalAdditions,
 		SafetyNotes:       []string{"Never mix chemicals directly.", "Wear gloves and eye protection.", "Always retest before additional chemical additions."},
 		RetestInHours:     retestHours,
 		WhenToCallPro:     []string{"If strong chlorine odor persists with high CC", "If water remains cloudy after 24-48h", "If pump/filter has abnormal pressure or electrical issues"},
 	}
+	plan = ApplyReadingIssues(plan, CheckDiagnoseContext(context, time.Now()))
+	tenant := ""
+	if context != nil {
+		tenant = context.Tenant
+	}
+	plan.EstimatedCost = PlanCost(plan, tenant)
+	return plan
 }
 
 func HasOpenAIKey() bool { return os.Getenv("OPENAI_API_KEY") != "" }
@@ -151,9 +265,17 @@ func ValidateDiagnoseRequest(req DiagnoseRequest) error {
 		return fmt.Errorf("poolId is required")
 	}
 	hasSymptoms := strings.TrimSpace(req.Symptoms) != ""
-	hasReadings := req.Context != nil && req.Context.LatestTest != nil
+	hasReadings := req.Context != nil && (req.Context.LatestTest != nil || len(req.Context.FCHistory) > 0 || req.Context.OvernightLoss != nil)
 	if !hasSymptoms && !hasReadings {
-		return fmt.Errorf("provide symptoms or latestTest readings")
+		return fmt.Errorf("provide symptoms, latestTest readings or fcHistory")
+	}
+	if req.Context != nil {
+		if _, err := resolveUnitSystem(req.Context.UnitSystem); err != nil {
+			return err
+		}
+		if _, err := resolveBodyOfWater(req.Context.BodyOfWater); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -164,10 +286,23 @@ func buildDiagnoseUserPrompt(symptoms string, context *DiagnoseContext) string {
 		fmt.Sprintf("Symptoms: %s", nonEmptyOrDefault(strings.TrimSpace(symptoms), "none provided")),
 	}
 
+	context = normalizeDiagnoseContext(context)
 	if context != nil {
+		metric := false
+		if system, _ := resolveUnitSystem(context.UnitSystem); system == UnitsMetric {
+			metric = true
+			lines = append(lines, "Use metric units (liters, ml, grams, kg, Celsius) for every amount in the plan.")
+		}
 		lines = append(lines, "Pool profile:")
+		if body, _ := resolveBodyOfWater(context.BodyOfWater); body != BodyPool {
+			lines = append(lines, fmt.Sprintf("- body_of_water: %s", body))
+		}
 		if context.PoolVolumeGallons != nil {
-			lines = append(lines, fmt.Sprintf("- volume_gallons: %.0f", *context.PoolVolumeGallons))
+			if metric {
+				lines = append(lines, fmt.Sprintf("- volume_liters: %.0f", gallonsToLiters(*context.PoolVolumeGallons)))
+			} else {
+				lines = append(lines, fmt.Sprintf("- volume_gallons: %.0f", *context.PoolVolumeGallons))
+			}
 		}
 		if strings.TrimSpace(context.SurfaceType) != "" {
 			lines = append(lines, fmt.Sprintf("- surface_type: %s", strings.TrimSpace(context.SurfaceType)))
@@ -189,6 +324,12 @@ func buildDiagnoseUserPrompt(symptoms string, context *DiagnoseContext) string {
 			if context.LatestTest.CC != nil {
 				lines = append(lines, fmt.Sprintf("- cc: %.2f", *context.LatestTest.CC))
 			}
+			if context.LatestTest.TC != nil {
+				lines = append(lines, fmt.Sprintf("- tc: %.2f", *context.LatestTest.TC))
+			}
+			if context.LatestTest.Bromine != nil {
+				lines = append(lines, fmt.Sprintf("- bromine: %.2f", *context.LatestTest.Bromine))
+			}
 			if context.LatestTest.PH != nil {
 				lines = append(lines, fmt.Sprintf("- ph: %.2f", *context.LatestTest.PH))
 			}
@@ -205,8 +346,36 @@ func buildDiagnoseUserPrompt(symptoms string, context *DiagnoseContext) string {
 				lines = append(lines, fmt.Sprintf("- salt: %.2f", *context.LatestTest.Salt))
 			}
 			if context.LatestTest.TempF != nil {
-				lines = append(lines, fmt.Sprintf("- temp_f: %.2f", *context.LatestTest.TempF))
+				if metric {
+					lines = append(lines, fmt.Sprintf("- temp_c: %.2f", fahrenheitToCelsius(*context.LatestTest.TempF)))
+				} else {
+					lines = append(lines, fmt.Sprintf("- temp_f: %.2f", *context.LatestTest.TempF))
+				}
+			}
+			if context.LatestTest.Borates != nil {
+				lines = append(lines, fmt.Sprintf("- borates: %.2f", *context.LatestTest.Borates))
+			}
+			if context.LatestTest.TDS != nil {
+				lines = append(lines, fmt.Sprintf("- tds: %.2f", *context.LatestTest.TDS))
+			}
+			if context.LatestTest.Phosphates != nil {
+				lines = append(lines, fmt.Sprintf("- phosphates_ppb: %.0f", *context.LatestTest.Phosphates))
+			}
+			if context.LatestTest.Iron != nil {
+				lines = append(lines, fmt.Sprintf("- iron: %.2f", *context.LatestTest.Iron))
+			}
+			if context.LatestTest.Copper != nil {
+				lines = append(lines, fmt.Sprintf("- copper: %.2f", *context.LatestTest.Copper))
+			}
+		}
+		if len(context.FCHistory) > 0 || context.OvernightLoss != nil {
+			demand := EstimateChlorineDemand(ChlorineDemandInput{FCHistory: context.FCHistory, OvernightLoss: context.OvernightLoss})
+			lines = append(lines, "Chlorine demand:")
+			lines = append(lines, fmt.Sprintf("- daily_demand_ppm: %.1f", demand.DailyDemand))
+			if demand.OvernightLoss != nil {
+				lines = append(lines, fmt.Sprintf("- overnight_loss_ppm: %.1f", *demand.OvernightLoss))
 			}
+			lines = append(lines, fmt.Sprintf("- status: %s", demand.Status))
 		}
 	}
 
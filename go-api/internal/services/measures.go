@@ -0,0 +1,233 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Measure is a container or scoop a tech pours from. Step is the smallest
+// fraction of it worth using (0.25 for a jug, 1 for a cup).
+type Measure struct {
+	Name   string  `json:"name"`
+	Plural string  `json:"plural"`
+	Size   float64 `json:"size"`
+	Unit   string  `json:"unit"`
+	Step   float64 `json:"step"`
+}
+
+// MeasureSet lists measures largest first. Chemicals overrides the liquid
+// or dry defaults for a chemical prefix.
+type MeasureSet struct {
+	Liquid    []Measure            `json:"liquid"`
+	Dry       []Measure            `json:"dry"`
+	Chemicals map[string][]Measure `json:"chemicals"`
+}
+
+type MeasureCatalog struct {
+	Imperial MeasureSet `json:"imperial"`
+	Metric   MeasureSet `json:"metric"`
+}
+
+var builtinMeasureCatalog = MeasureCatalog{
+	Imperial: MeasureSet{
+		Liquid: []Measure{
+			{"jug (1 gal)", "jugs (1 gal)", 1, "gallons", 0.25},
+			{"cup", "cups", 1, "cup", 1},
+		},
+		Dry: []Measure{
+			{"scoop (2 lb)", "scoops (2 lb)", 2, "lb", 0.5},
+			{"cup", "cups", 1, "cup", 1},
+		},
+		Chemicals: map[string][]Measure{
+			"pool_salt": {
+				{"bag (40 lb)", "bags (40 lb)", 40, "lb", 0.5},
+				{"scoop (2 lb)", "scoops (2 lb)", 2, "lb", 0.5},
+			},
+		},
+	},
+	Metric: MeasureSet{
+		Liquid: []Measure{
+			{"bottle (5 L)", "bottles (5 L)", 5, "liters", 0.25},
+			{"measuring jug (1 L)", "measuring jugs (1 L)", 1, "liters", 0.25},
+		},
+		Dry: []Measure{
+			{"scoop (1 kg)", "scoops (1 kg)", 1, "kg", 0.5},
+			{"cup (250 ml)", "cups (250 ml)", 250, "ml", 1},
+		},
+		Chemicals: map[string][]Measure{
+			"pool_salt": {
+				{"bag (20 kg)", "bags (20 kg)", 20, "kg", 0.5},
+				{"scoop (1 kg)", "scoops (1 kg)", 1, "kg", 0.5},
+			},
+		},
+	},
+}
+
+// Volume measures in teaspoons; dry chemicals convert through their bulk
+// density. Weight measures in weight ounces.
+var (
+	teaspoonsPerUnit = map[string]float64{
+		"tsp": 1, "tbsp": teaspoonsPerTablespoon, "cup": 48, "oz": teaspoonsPerFluidOz,
+		"ml": teaspoonsPerFluidOz / mlPerFluidOz, "liters": 1000 * teaspoonsPerFluidOz / mlPerFluidOz, "gallons": 128 * teaspoonsPerFluidOz,
+	}
+	weightOzPerUnit = map[string]float64{"oz": 1, "lb": 16, "g": 1 / gramsPerOz, "kg": 1000 / gramsPerOz}
+)
+
+// practicalParts keeps the phrase readable: "1 jug (1 gal) + 3 cups".
+const practicalParts = 2
+
+// unpracticalUnits are already a practical measure.
+var unpracticalUnits = map[string]bool{"tsp": true, "tbsp": true, "tablets": true}
+
+var (
+	measureMu      sync.RWMutex
+	measureCatalog = builtinMeasureCatalog
+)
+
+// LoadMeasureCatalog reads and validates a measure catalog file and
+// replaces the active catalog. Nothing changes when validation fails.
+func LoadMeasureCatalog(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var catalog MeasureCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("measure catalog %s: %w", path, err)
+	}
+	for system, set := range map[string]MeasureSet{UnitsImperial: catalog.Imperial, UnitsMetric: catalog.Metric} {
+		if err := validateMeasures(system+" liquid", set.Liquid, true); err != nil {
+			return err
+		}
+		if err := validateMeasures(system+" dry", set.Dry, false); err != nil {
+			return err
+		}
+		for chemical, measures := range set.Chemicals {
+			if err := validateMeasures(system+" "+chemical, measures, isLiquidChemical(chemical)); err != nil {
+				return err
+			}
+		}
+	}
+	measureMu.Lock()
+	measureCatalog = catalog
+	measureMu.Unlock()
+	return nil
+}
+
+func validateMeasures(scope string, measures []Measure, liquid bool) error {
+	for i, m := range measures {
+		_, volume := teaspoonsPerUnit[m.Unit]
+		_, weight := weightOzPerUnit[m.Unit]
+		switch {
+		case strings.TrimSpace(m.Name) == "" || strings.TrimSpace(m.Plural) == "":
+			return fmt.Errorf("%s measure %d: name and plural are required", scope, i)
+		case !volume && !weight, liquid && !volume:
+			return fmt.Errorf("%s measure %d: unit %q cannot measure this", scope, i, m.Unit)
+		case m.Size <= 0 || m.Step <= 0 || m.Step > 1:
+			return fmt.Errorf("%s measure %d: size must be positive and step in (0, 1]", scope, i)
+		}
+	}
+	return nil
+}
+
+// measureOz is the size of a measure in the dose's base ounces: fluid
+// ounces for liquids, weight ounces otherwise.
+func measureOz(chemical string, m Measure) float64 {
+	liquid := isLiquidChemical(chemical)
+	if oz, ok := weightOzPerUnit[m.Unit]; ok && !liquid {
+		return m.Size * oz
+	}
+	tsp := m.Size * teaspoonsPerUnit[m.Unit]
+	if liquid {
+		return tsp / teaspoonsPerFluidOz
+	}
+	return tsp * gramsPerTeaspoonFor(chemical) / gramsPerOz
+}
+
+func measuresFor(set MeasureSet, chemical string) []Measure {
+	best := ""
+	for prefix := range set.Chemicals {
+		if strings.HasPrefix(chemical, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return set.Chemicals[best]
+	}
+	if isLiquidChemical(chemical) {
+		return set.Liquid
+	}
+	return set.Dry
+}
+
+// practicalMeasure phrases a dose in the catalog's measures. Every part
+// rounds down and the remainder is dropped, so the poured amount never
+// exceeds the dose. Doses smaller than the smallest step are left empty.
+func practicalMeasure(d Dose, system string) string {
+	if unpracticalUnits[d.Unit] {
+		return ""
+	}
+	remaining, ok := doseOz(d.Chemical, d.Amount, d.Unit)
+	if !ok || remaining <= 0 {
+		return ""
+	}
+	measureMu.RLock()
+	set := measureCatalog.Imperial
+	if system == UnitsMetric {
+		set = measureCatalog.Metric
+	}
+	measures := measuresFor(set, d.Chemical)
+	measureMu.RUnlock()
+
+	var parts []string
+	for _, m := range measures {
+		if len(parts) == practicalParts {
+			break
+		}
+		size := measureOz(d.Chemical, m)
+		// The epsilon absorbs float error so an exact fit is not rounded down.
+		count := math.Floor(remaining/(size*m.Step)+1e-9) * m.Step
+		if count <= 0 {
+			continue
+		}
+		parts = append(parts, measurePhrase(count, m))
+		remaining -= count * size
+	}
+	return strings.Join(parts, " + ")
+}
+
+var fractionWords = map[float64]string{0.25: "a quarter of a", 0.5: "half a", 0.75: "three quarters of a"}
+
+var fractionGlyphs = map[float64]string{0.25: "1/4", 0.5: "1/2", 0.75: "3/4"}
+
+func measurePhrase(count float64, m Measure) string {
+	whole, frac := math.Modf(count)
+	frac = math.Round(frac*100) / 100
+	if whole == 0 {
+		if words, ok := fractionWords[frac]; ok {
+			return words + " " + m.Name
+		}
+		return fmt.Sprintf("%g %s", count, m.Name)
+	}
+	n := fmt.Sprintf("%.0f", whole)
+	if glyph, ok := fractionGlyphs[frac]; ok {
+		n += " " + glyph
+	} else if frac > 0 {
+		n = fmt.Sprintf("%g", count)
+	}
+	if count == 1 {
+		return n + " " + m.Name
+	}
+	return n + " " + m.Plural
+}
+
+// withPractical fills Practical on each dose.
+func withPractical(doses []Dose, system string) {
+	for i := range doses {
+		doses[i].Practical = practicalMeasure(doses[i], system)
+	}
+}
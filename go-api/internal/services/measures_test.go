@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestMeasureCatalog(t *testing.T, body string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "measures.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { measureCatalog = builtinMeasureCatalog })
+	return LoadMeasureCatalog(path)
+}
+
+func TestCalculateDosingAddsPracticalMeasures(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "ta": 70, "cya": 30},
+		Targets:           map[string]float64{"fc": 4, "ta": 80},
+	})
+	if out.Doses[0].Practical != "a quarter of a jug (1 gal)" || out.Doses[1].Practical != "half a scoop (2 lb)" {
+		t.Fatalf("unexpected practical measures: %+v", out.Doses)
+	}
+	if out.Sequence[0].Practical != "half a scoop (2 lb)" {
+		t.Fatalf("expected practical measures on sequence, got %+v", out.Sequence)
+	}
+}
+
+func TestPracticalMeasureRoundsDown(t *testing.T) {
+	cases := []struct {
+		dose Dose
+		want string
+	}{
+		{Dose{"liquid_chlorine_10pct", 64, "oz", "", ""}, "half a jug (1 gal)"},
+		{Dose{"liquid_chlorine_10pct", 57.3, "oz", "", ""}, "a quarter of a jug (1 gal) + 3 cups"},
+		{Dose{"sodium_bicarbonate", 2.1, "lb", "", ""}, "1 scoop (2 lb)"},
+		{Dose{"pool_salt", 95, "lb", "", ""}, "2 bags (40 lb) + 7 1/2 scoops (2 lb)"},
+		{Dose{"sodium_bicarbonate", 1.5, "oz", "", ""}, ""},
+		{Dose{"muriatic_acid_31_45pct", 1.2, "tsp", "", ""}, ""},
+	}
+	for _, c := range cases {
+		if got := practicalMeasure(c.dose, UnitsImperial); got != c.want {
+			t.Errorf("%+v: expected %q, got %q", c.dose, c.want, got)
+		}
+	}
+	if got := practicalMeasure(Dose{"pool_salt", 45, "kg", "", ""}, UnitsMetric); got != "2 bags (20 kg) + 5 scoops (1 kg)" {
+		t.Fatalf("unexpected metric salt measure %q", got)
+	}
+}
+
+func TestBuildFallbackPlanAddsPracticalMeasure(t *testing.T) {
+	gallons := 30000.0
+	plan := BuildFallbackPlanWithContext("green", &DiagnoseContext{PoolVolumeGallons: &gallons})
+	if got := plan.ChemicalAdditions[0]["practical"]; got != "three quarters of a jug (1 gal)" {
+		t.Fatalf("expected 96 oz as three quarters of a jug, got %q", got)
+	}
+}
+
+func TestLoadMeasureCatalog(t *testing.T) {
+	data, err := os.ReadFile("../../rules/measure-catalog.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestMeasureCatalog(t, string(data)); err != nil {
+		t.Fatalf("example catalog should load: %v", err)
+	}
+	if got := practicalMeasure(Dose{"muriatic_acid_31_45pct", 96, "oz", "", ""}, UnitsImperial); got != "half a jug (1 gal) + 4 cups" {
+		t.Fatalf("expected acid override in half jugs, got %q", got)
+	}
+	err = loadTestMeasureCatalog(t, `{"imperial": {"liquid": [{"name": "bucket", "plural": "buckets", "size": 10, "unit": "lb", "step": 1}]}}`)
+	if err == nil || !strings.Contains(err.Error(), "cannot measure") {
+		t.Fatalf("expected liquid measured by weight to be rejected, got %v", err)
+	}
+	if measureCatalog.Imperial.Chemicals["muriatic_acid"] == nil {
+		t.Fatal("expected failed load to keep the previous catalog")
+	}
+}
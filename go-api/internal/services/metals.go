@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Iron and copper are read in ppm. Above metalStainThreshold, oxidizing
+// them (shocking) drops them out as stains or colors the water, so they are
+// sequestered first.
+const (
+	metalStainThreshold = 0.2
+	// sequestrantOzPer10k is the initial dose for up to 1 ppm of total
+	// metals; heavier loads scale with the reading.
+	sequestrantOzPer10k = 32
+	sequestrantCapOz    = 128
+	// sequestrantShockWaitHours lets the sequestrant bind metals before FC
+	// is raised.
+	sequestrantShockWaitHours = 24
+)
+
+// vitaminCStainTest tells metal stains from organic ones before anything is
+// dosed.
+var vitaminCStainTest = []string{
+	"Vitamin C stain test: hold a vitamin C tablet (or a sock of ascorbic acid) against the stain for 30 seconds",
+	"If the stain lightens, it is metal (iron or copper): treat with sequestrant and do not shock",
+	"If it does not, hold a trichlor tablet against it; a stain that lightens then is organic and chlorine will clear it",
+}
+
+// Symptom phrases that point to dissolved metals rather than algae. They are
+// specific on purpose: "brown" or "green" alone describes algae as often as
+// metals.
+var (
+	ironPhrases   = []string{"brown stain", "brown water", "rust stain", "rust colored", "rust-colored", "tea colored", "tea-colored"}
+	copperPhrases = []string{"blue-green stain", "blue green stain", "blue stain", "teal water", "green hair", "hair turned green"}
+	metalPhrases  = []string{"metal stain", "green after shock", "green after a shock", "green after the shock", "green right after shock"}
+	// algaePhrases win over the metal phrases, so "mustard algae, brown
+	// stain" is still treated as algae unless a test measures metals.
+	algaePhrases = []string{"algae", "slime", "slimy"}
+)
+
+func containsAny(text string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// metalsDose sizes a sequestrant when iron or copper is above the stain
+// threshold, and warns when the visit also raises chlorine.
+func metalsDose(in CalcInput, pool float64, out *CalcOutput) {
+	metals := in.Readings["iron"] + in.Readings["copper"]
+	if in.Readings["iron"] <= metalStainThreshold && in.Readings["copper"] <= metalStainThreshold {
+		return
+	}
+	oz := capDose(sequestrantOzPer10k*math.Max(1, metals)*(pool/10000), doseCap(in, pool, sequestrantCapOz))
+	out.Doses = append(out.Doses, Dose{"metal_sequestrant", oz, "oz", "Add first with the pump running; repeat weekly at a quarter dose while metals test above 0.2 ppm.", ""})
+	for _, d := range out.Doses {
+		if isChlorineChemical(d.Chemical) {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("Metals are %.1f ppm; add the sequestrant and wait %dh before raising chlorine, or the metals will stain.", metals, sequestrantShockWaitHours))
+			break
+		}
+	}
+	if in.Readings["copper"] > metalStainThreshold {
+		out.Assumptions = append(out.Assumptions, "Copper usually comes from an ionizer, copper algaecide or a heater exchanger corroded by low pH; check the source.")
+	}
+}
+
+// metalsFallback replaces the chlorine plan when the symptoms or the latest
+// test point to dissolved metals. Green water that appeared right after a
+// shock is metals, not algae; symptoms that mention algae are left to the
+// chlorine plan.
+func metalsFallback(symptoms string, context *DiagnoseContext) (string, []string, map[string]string, bool) {
+	text := strings.ToLower(symptoms)
+	iron, copper, found := false, false, false
+	if !containsAny(text, algaePhrases) {
+		iron, copper = containsAny(text, ironPhrases), containsAny(text, copperPhrases)
+		found = iron || copper || containsAny(text, metalPhrases)
+	}
+	var measured []string
+	total := 0.0
+	if context != nil && context.LatestTest != nil {
+		if v := context.LatestTest.Iron; v != nil && *v > metalStainThreshold {
+			iron, found = true, true
+			measured = append(measured, fmt.Sprintf("iron %.1f ppm", *v))
+			total += *v
+		}
+		if v := context.LatestTest.Copper; v != nil && *v > metalStainThreshold {
+			copper, found = true, true
+			measured = append(measured, fmt.Sprintf("copper %.1f ppm", *v))
+			total += *v
+		}
+	}
+	if !found {
+		return "", nil, nil, false
+	}
+
+	metal := "iron or copper"
+	switch {
+	case iron && !copper:
+		metal = "iron"
+	case copper && !iron:
+		metal = "copper"
+	}
+	diagnosis := fmt.Sprintf("Likely dissolved metals (%s) discoloring the water or staining surfaces, not algae.", metal)
+	steps := append([]string{}, vitaminCStainTest...)
+	if len(measured) > 0 {
+		steps = append([]string{fmt.Sprintf("Test shows %s, above the %.1f ppm stain threshold", strings.Join(measured, " and "), metalStainThreshold)}, steps...)
+	} else {
+		steps = append(steps, "Test iron and copper to confirm before treating")
+	}
+	steps = append(steps,
+		fmt.Sprintf("Do not shock; add sequestrant and wait %dh before raising chlorine", sequestrantShockWaitHours),
+		"Keep pH at 7.2-7.6; high pH drops metals out of solution and low pH corrodes copper heaters",
+		"Top up with filtered or non-well water if the fill water carries iron",
+	)
+
+	oz := sequestrantOzPer10k * math.Max(1, total)
+	if context != nil && context.PoolVolumeGallons != nil {
+		oz = round2(*context.PoolVolumeGallons / 10000 * oz)
+	}
+	addition := map[string]string{
+		"chemical":     "metal_sequestrant",
+		"amount":       fmt.Sprintf("%g", oz),
+		"unit":         "oz",
+		"instructions": "Add with the pump running after the stain test confirms metals; do not shock for 24 hours.",
+	}
+	return diagnosis, steps, addition, true
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingSequestersMetals(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 1, "cya": 40, "iron": 0.8, "copper": 0.6},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	var sequestrant *Dose
+	for i := range out.Doses {
+		if out.Doses[i].Chemical == "metal_sequestrant" {
+			sequestrant = &out.Doses[i]
+		}
+	}
+	// 32 oz per 10k gallons per ppm of total metals: 1.4 ppm over 20k gallons.
+	if sequestrant == nil || sequestrant.Amount != 89.6 {
+		t.Fatalf("expected scaled sequestrant dose, got %+v", out.Doses)
+	}
+	if out.Sequence[0].Chemical != "metal_sequestrant" {
+		t.Fatalf("expected sequestrant first, got %+v", out.Sequence)
+	}
+	if len(out.Warnings) == 0 || !strings.Contains(out.Warnings[0], "wait 24h before raising chlorine") {
+		t.Fatalf("expected shock warning, got %v", out.Warnings)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "Copper usually comes from") {
+		t.Fatalf("expected copper source assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestCalculateDosingIgnoresTraceMetals(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 3, "cya": 40, "iron": 0.1},
+		Targets:           map[string]float64{"fc": 3},
+	})
+	if len(out.Doses) != 0 {
+		t.Fatalf("expected no sequestrant for trace iron, got %+v", out.Doses)
+	}
+}
+
+func TestBuildFallbackPlanGreenAfterShockIsMetals(t *testing.T) {
+	gallons := 20000.0
+	plan := BuildFallbackPlanWithContext("water turned green after shock but is clear", &DiagnoseContext{PoolVolumeGallons: &gallons})
+	if !strings.Contains(plan.Diagnosis, "dissolved metals (iron or copper)") {
+		t.Fatalf("expected metals diagnosis, got %q", plan.Diagnosis)
+	}
+	add := plan.ChemicalAdditions[0]
+	if add["chemical"] != "metal_sequestrant" || add["amount"] != "64" {
+		t.Fatalf("expected sequestrant instead of chlorine, got %v", add)
+	}
+	steps := strings.Join(plan.Steps, " | ")
+	if !strings.Contains(steps, "Vitamin C stain test") || !strings.Contains(steps, "Test iron and copper") {
+		t.Fatalf("expected stain test and metal test steps, got %v", plan.Steps)
+	}
+}
+
+func TestBuildFallbackPlanMeasuredCopper(t *testing.T) {
+	fc, copper := 1.0, 0.5
+	plan := BuildFallbackPlanWithContext("blue-green stains on the steps", &DiagnoseContext{BodyOfWater: "spa", LatestTest: &DiagnoseWaterTest{FC: &fc, Copper: &copper}})
+	if !strings.Contains(plan.Diagnosis, "(copper)") {
+		t.Fatalf("expected copper diagnosis despite low FC, got %q", plan.Diagnosis)
+	}
+	if add := plan.ChemicalAdditions[0]; add["chemical"] != "metal_sequestrant" || add["unit"] != "tbsp" {
+		t.Fatalf("expected spa-sized sequestrant, got %v", add)
+	}
+	if !strings.HasPrefix(plan.Steps[0], "Test shows copper 0.5 ppm") {
+		t.Fatalf("expected measured copper first, got %v", plan.Steps)
+	}
+}
+
+func TestBuildFallbackPlanGreenStillAlgae(t *testing.T) {
+	plan := BuildFallbackPlan("green and cloudy")
+	if plan.ChemicalAdditions[0]["chemical"] != "liquid_chlorine_10pct" {
+		t.Fatalf("expected plain green water to get chlorine, got %v", plan.ChemicalAdditions)
+	}
+}
+
+func TestBuildFallbackPlanAlgaeWordsBeatMetalPhrases(t *testing.T) {
+	for _, symptoms := range []string{"mustard algae, brownish", "green algae with a brown stain on the steps", "brown and cloudy", "blue water, a bit green"} {
+		plan := BuildFallbackPlan(symptoms)
+		if strings.Contains(plan.Diagnosis, "dissolved metals") || plan.ChemicalAdditions[0]["chemical"] == "metal_sequestrant" {
+			t.Errorf("%q: expected no sequestrant, got %q %v", symptoms, plan.Diagnosis, plan.ChemicalAdditions)
+		}
+	}
+}
+
+func TestBuildFallbackPlanIronStain(t *testing.T) {
+	plan := BuildFallbackPlan("rust-colored stains around the return jets")
+	if !strings.Contains(plan.Diagnosis, "(iron)") {
+		t.Fatalf("expected iron diagnosis, got %q", plan.Diagnosis)
+	}
+}
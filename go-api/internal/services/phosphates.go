@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Phosphates are read in ppb. They are algae food once sanitizer lapses;
+// removal pays off above phosphateAction, down to phosphateTarget. Above
+// phosphateHeavy a full dose clouds the water and loads the filter, so at
+// most half is removed per visit.
+const (
+	phosphateTarget = 100
+	phosphateAction = 500
+	phosphateHeavy  = 2500
+)
+
+// phosphateProduct removes phosphates. PPBPerOzPer10k is the drop from one
+// fluid ounce in 10k gallons.
+type phosphateProduct struct {
+	Chemical       string
+	PPBPerOzPer10k float64
+	CapOz          float64
+	Notes          string
+}
+
+var phosphateProducts = map[string]phosphateProduct{
+	// 1 qt removes about 1,000 ppb in 10k gallons.
+	"standard": {"phosphate_remover", 1000.0 / 32, 64, "Pour slowly in front of the returns with the filter running; expect cloudiness for a day and clean or backwash the filter after 24-48h."},
+	// 1 L removes about 10,000 ppb in 10k gallons.
+	"concentrated": {"phosphate_remover_concentrated", 10000 / (1000 / mlPerFluidOz), 34, "Concentrated; pre-dilute in a bucket of pool water and pour slowly in front of the returns. Clean or backwash the filter after 24-48h."},
+}
+
+// enzymeDoses are fluid ounces per 10k gallons of an enzyme clarifier, which
+// digests oils and organics that feed algae and consume chlorine.
+var enzymeDoses = map[string]float64{
+	"initial": 32,
+	"weekly":  8,
+}
+
+// phosphateDose sizes the remover that brings phosphates down to target with
+// the selected product (Products["phosphates"]: "standard", the default, or
+// "concentrated").
+func phosphateDose(in CalcInput, pool float64, out *CalcOutput) {
+	t, r, ok := targetBelow(in, "phosphates")
+	if !ok {
+		return
+	}
+	key := in.Products["phosphates"]
+	product, found := phosphateProducts[key]
+	if !found {
+		if key != "" {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown phosphate remover %q; dosed as the standard strength.", key))
+		}
+		product = phosphateProducts["standard"]
+	}
+	drop := r - math.Max(t, 0)
+	if r > phosphateHeavy {
+		drop = math.Min(drop, r/2)
+		out.Warnings = append(out.Warnings, fmt.Sprintf("Phosphates are %.0f ppb; remove in stages, cleaning the filter between doses.", r))
+	}
+	oz := capDose(drop/product.PPBPerOzPer10k*(pool/10000), doseCap(in, pool, product.CapOz))
+	out.Doses = append(out.Doses, Dose{product.Chemical, oz, "oz", product.Notes, ""})
+}
+
+// enzymeDose adds an enzyme clarifier for in.Enzyme ("initial" or "weekly").
+func enzymeDose(in CalcInput, pool float64, out *CalcOutput) {
+	schedule := strings.ToLower(strings.TrimSpace(in.Enzyme))
+	if schedule == "" {
+		return
+	}
+	ozPer10k, ok := enzymeDoses[schedule]
+	if !ok {
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown enzyme schedule %q; no enzyme dosed.", in.Enzyme))
+		return
+	}
+	out.Doses = append(out.Doses, Dose{"enzyme_clarifier", ozPer10k * pool / 10000, "oz", "Add to the skimmer with the pump running; enzymes work alongside chlorine, not instead of it.", ""})
+}
+
+// phosphateFallbackSteps explain chronic or recurring algae. Phosphates are
+// only blamed when the symptoms say the algae keeps returning or a test
+// shows them high, so a one-off green pool is still treated as sanitizer.
+func phosphateFallbackSteps(symptoms string, context *DiagnoseContext) []string {
+	text := strings.ToLower(symptoms)
+	algae := strings.Contains(text, "algae") || strings.Contains(text, "green")
+	chronic := algae && (strings.Contains(text, "keeps") || strings.Contains(text, "again") || strings.Contains(text, "recurring") ||
+		strings.Contains(text, "chronic") || strings.Contains(text, "comes back") || strings.Contains(text, "every week"))
+	var phosphates *float64
+	if context != nil && context.LatestTest != nil {
+		phosphates = context.LatestTest.Phosphates
+	}
+	switch {
+	case phosphates != nil && *phosphates > phosphateAction:
+		return []string{
+			fmt.Sprintf("Phosphates are %.0f ppb; after the algae is cleared, dose phosphate remover to bring them below %d ppb", *phosphates, phosphateTarget),
+			"Add a weekly enzyme clarifier to break down the organics that keep feeding phosphates",
+		}
+	case chronic && phosphates == nil:
+		return []string{fmt.Sprintf("Recurring algae often means high phosphates; test phosphates (ppb) and treat above %d ppb", phosphateAction)}
+	}
+	return nil
+}
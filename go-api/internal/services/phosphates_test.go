@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingPhosphateRemover(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		AutoTargets:       true,
+		Readings:          map[string]float64{"fc": 3, "cya": 40, "phosphates": 1100},
+		Targets:           map[string]float64{"fc": 3},
+	})
+	if out.TargetRanges["phosphates"].Max != phosphateAction {
+		t.Fatalf("expected phosphate range in profile, got %+v", out.TargetRanges)
+	}
+	// 1000 ppb at 31.25 ppb per oz per 10k gallons, over 20k gallons.
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "phosphate_remover" || out.Doses[0].Amount != 64 {
+		t.Fatalf("expected capped phosphate remover dose, got %+v", out.Doses)
+	}
+}
+
+func TestCalculateDosingConcentratedRemoverStagesHeavyLoad(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 3, "cya": 40, "phosphates": 4000},
+		Targets:           map[string]float64{"phosphates": 100},
+		Products:          map[string]string{"phosphates": "concentrated"},
+		Simulate:          true,
+	})
+	d := out.Doses[0]
+	if d.Chemical != "phosphate_remover_concentrated" || d.Amount != 6.8 {
+		t.Fatalf("expected half the load removed with concentrate, got %+v", d)
+	}
+	if len(out.Warnings) == 0 || !strings.Contains(out.Warnings[0], "in stages") {
+		t.Fatalf("expected staging warning, got %v", out.Warnings)
+	}
+	if got := out.Predicted.After["phosphates"]; got != 2000 {
+		t.Fatalf("expected the dose to drop phosphates to 2000, got %v", got)
+	}
+}
+
+func TestCalculateDosingEnzyme(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"fc": 3, "cya": 40},
+		Targets:           map[string]float64{"fc": 3},
+		Enzyme:            "weekly",
+		Simulate:          true,
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "enzyme_clarifier" || out.Doses[0].Amount != 12 {
+		t.Fatalf("expected 12 oz weekly enzyme, got %+v", out.Doses)
+	}
+	if out.Predicted.Confidence == "Low" {
+		t.Fatalf("expected enzyme to simulate as no change, got %+v", out.Predicted)
+	}
+	out = CalculateDosing(CalcInput{PoolVolumeGallons: 15000, Readings: map[string]float64{"cya": 40}, Targets: map[string]float64{}, Enzyme: "daily"})
+	if !strings.Contains(strings.Join(out.Assumptions, " "), `Unknown enzyme schedule "daily"`) {
+		t.Fatalf("expected unknown schedule assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestBuildFallbackPlanPhosphates(t *testing.T) {
+	plan := BuildFallbackPlan("algae keeps coming back every week")
+	if !strings.Contains(plan.Diagnosis, "Phosphates") || !strings.Contains(strings.Join(plan.Steps, " | "), "test phosphates") {
+		t.Fatalf("expected recurring algae to suggest a phosphate test, got %+v", plan)
+	}
+	phosphates := 1500.0
+	plan = BuildFallbackPlanWithContext("green", &DiagnoseContext{LatestTest: &DiagnoseWaterTest{Phosphates: &phosphates}})
+	if !strings.Contains(strings.Join(plan.Steps, " | "), "Phosphates are 1500 ppb") {
+		t.Fatalf("expected measured phosphates step, got %v", plan.Steps)
+	}
+	plan = BuildFallbackPlan("green pool")
+	if strings.Contains(plan.Diagnosis, "Phosphates") {
+		t.Fatalf("expected one-off algae to blame sanitizer only, got %q", plan.Diagnosis)
+	}
+}
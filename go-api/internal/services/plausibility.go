@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Issue severities. Info never changes the result, a warning lowers
+// confidence one level and a severe issue blocks dosing until the water is
+// retested.
+const (
+	IssueInfo    = "info"
+	IssueWarning = "warning"
+	IssueSevere  = "severe"
+)
+
+// ReadingIssue flags an implausible or inconsistent reading.
+type ReadingIssue struct {
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// plausibleRanges are the physical limits of each reading; anything outside
+// is a typo or a failed test.
+var plausibleRanges = map[string][2]float64{
+	"fc":         {0, 50},
+	"cc":         {0, 20},
+	"tc":         {0, 50},
+	"ph":         {0, 14},
+	"ta":         {0, 500},
+	"ch":         {0, 2000},
+	"cya":        {0, 300},
+	"salt":       {0, 10000},
+	"br":         {0, 30},
+	"bromide":    {0, 100},
+	"borates":    {0, 200},
+	"tds":        {0, 20000},
+	"phosphates": {0, 50000},
+	"iron":       {0, 10},
+	"copper":     {0, 10},
+	"tempF":      {32, 115},
+	"tempC":      {0, 46},
+}
+
+// Phenol red reads 6.8-8.2; a drop-kit value at either end is clipped.
+const (
+	phKitMin = 6.8
+	phKitMax = 8.2
+	// fcBleachesPH is the FC above which phenol red reads pH falsely high.
+	fcBleachesPH = 10
+	// saltOnChlorinePool is more salt than liquid chlorine alone leaves.
+	saltOnChlorinePool = 2000
+	futureTestSlack    = 5 * time.Minute
+)
+
+// CheckReadings flags readings that are physically implausible, beyond
+// common test-kit ranges, or inconsistent with each other. testedAt is an
+// optional RFC3339 timestamp.
+func CheckReadings(readings map[string]float64, testedAt string, isSalt bool, now time.Time) []ReadingIssue {
+	issues := []ReadingIssue{}
+	add := func(field, severity, format string, args ...any) {
+		issues = append(issues, ReadingIssue{field, severity, fmt.Sprintf(format, args...)})
+	}
+
+	keys := make([]string, 0, len(readings))
+	for key := range readings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	implausible := map[string]bool{}
+	for _, key := range keys {
+		limits, ok := plausibleRanges[key]
+		if v := readings[key]; ok && (v < limits[0] || v > limits[1]) {
+			implausible[key] = true
+			add(key, IssueSevere, "%s %g is outside the plausible %g-%g range; retest.", key, v, limits[0], limits[1])
+		}
+	}
+	valid := func(key string) (float64, bool) {
+		v, ok := readings[key]
+		return v, ok && !implausible[key]
+	}
+
+	if ph, ok := valid("ph"); ok && (ph <= phKitMin || ph >= phKitMax) {
+		add("ph", IssueWarning, "pH %g is at or beyond the %g-%g phenol red range; if read from a drop kit the true value may be further out.", ph, phKitMin, phKitMax)
+	}
+	if tc, ok := valid("tc"); ok {
+		if cc, ok := valid("cc"); ok && cc > tc {
+			add("cc", IssueSevere, "CC %g is greater than total chlorine %g; CC is part of TC.", cc, tc)
+		}
+		if fc, ok := valid("fc"); ok && fc > tc {
+			add("fc", IssueSevere, "FC %g is greater than total chlorine %g; FC is part of TC.", fc, tc)
+		}
+	}
+	if fc, ok := valid("fc"); ok && fc > fcBleachesPH {
+		if _, hasPH := valid("ph"); hasPH {
+			add("ph", IssueWarning, "FC %g is above %d ppm, which makes phenol red read pH falsely high; retest pH after FC drops.", fc, fcBleachesPH)
+		}
+	}
+	if ta, ok := valid("ta"); ok {
+		if ph, ok := valid("ph"); ok && ta < 30 && ph >= 7.8 {
+			add("ta", IssueWarning, "TA %g with pH %g is unusual; check the TA reagent and titration count.", ta, ph)
+		}
+	}
+	if salt, ok := valid("salt"); ok && !isSalt && salt > saltOnChlorinePool {
+		add("salt", IssueWarning, "Salt %g ppm on a pool not marked as salt; confirm the sanitizer type or the salt meter.", salt)
+	}
+	if s := strings.TrimSpace(testedAt); s != "" {
+		at, err := time.Parse(time.RFC3339, s)
+		switch {
+		case err != nil:
+			add("testedAt", IssueWarning, "testedAt %q is not an RFC3339 timestamp.", s)
+		case at.After(now.Add(futureTestSlack)):
+			add("testedAt", IssueWarning, "testedAt %s is in the future; check the device clock.", s)
+		}
+	}
+	return issues
+}
+
+// CheckDiagnoseContext runs CheckReadings on the latest test in ctx.
+func CheckDiagnoseContext(ctx *DiagnoseContext, now time.Time) []ReadingIssue {
+	ctx = normalizeDiagnoseContext(ctx)
+	if ctx == nil || ctx.LatestTest == nil {
+		return []ReadingIssue{}
+	}
+	test := ctx.LatestTest
+	readings := map[string]float64{}
+	for key, v := range map[string]*float64{"fc": test.FC, "cc": test.CC, "tc": test.TC, "ph": test.PH, "ta": test.TA, "ch": test.CH, "cya": test.CYA, "salt": test.Salt, "br": test.Bromine, "borates": test.Borates, "tds": test.TDS, "phosphates": test.Phosphates, "iron": test.Iron, "copper": test.Copper, "tempF": test.TempF, "tempC": test.TempC} {
+		if v != nil {
+			readings[key] = *v
+		}
+	}
+	isSalt := ctx.IsSalt != nil && *ctx.IsSalt || strings.EqualFold(strings.TrimSpace(ctx.SanitizerType), "salt")
+	return CheckReadings(readings, test.TestedAt, isSalt, now)
+}
+
+func worstIssue(issues []ReadingIssue) string {
+	worst := ""
+	for _, issue := range issues {
+		switch {
+		case issue.Severity == IssueSevere:
+			return IssueSevere
+		case issue.Severity == IssueWarning:
+			worst = IssueWarning
+		}
+	}
+	return worst
+}
+
+func lowerConfidence(confidence string) string {
+	if confidence == "High" {
+		return "Medium"
+	}
+	return "Low"
+}
+
+// ApplyReadingIssues adjusts a diagnose plan for the issues found in its
+// readings: warnings lower confidence and severe issues replace the
+// chemical additions with a retest.
+func ApplyReadingIssues(plan DiagnosePlan, issues []ReadingIssue) DiagnosePlan {
+	switch worstIssue(issues) {
+	case IssueSevere:
+		plan.Confidence = "Low"
+		plan.ChemicalAdditions = []map[string]string{}
+		var retest []string
+		for _, issue := range issues {
+			if issue.Severity == IssueSevere {
+				retest = append(retest, "Retest before adding chemicals: "+issue.Message)
+			}
+		}
+		plan.Steps = append(retest, plan.Steps...)
+	case IssueWarning:
+		plan.Confidence = lowerConfidence(plan.Confidence)
+	}
+	return plan
+}
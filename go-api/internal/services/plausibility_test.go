@@ -0,0 +1,75 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReadingsFlagsInconsistentChlorine(t *testing.T) {
+	issues := CheckReadings(map[string]float64{"fc": 3, "cc": 2, "tc": 1.5}, "", false, time.Now())
+	if worstIssue(issues) != IssueSevere || len(issues) != 2 || issues[0].Field != "cc" || issues[1].Field != "fc" {
+		t.Fatalf("expected CC and FC above TC to be severe, got %+v", issues)
+	}
+}
+
+func TestCheckReadingsKitRangeWarns(t *testing.T) {
+	issues := CheckReadings(map[string]float64{"ph": 8.4, "ta": 120}, "", false, time.Now())
+	if len(issues) != 1 || issues[0].Severity != IssueWarning {
+		t.Fatalf("expected kit range warning, got %+v", issues)
+	}
+}
+
+func TestCheckReadingsTemperature(t *testing.T) {
+	issues := CheckReadings(map[string]float64{"tempF": -459.67, "tempC": 20}, "", false, time.Now())
+	if len(issues) != 1 || issues[0].Field != "tempF" || issues[0].Severity != IssueSevere {
+		t.Fatalf("expected implausible tempF only, got %+v", issues)
+	}
+	if issues = CheckReadings(map[string]float64{"tempC": 60}, "", false, time.Now()); len(issues) != 1 || issues[0].Field != "tempC" {
+		t.Fatalf("expected implausible tempC, got %+v", issues)
+	}
+}
+
+func TestCheckReadingsWarnings(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	issues := CheckReadings(map[string]float64{"ph": 7.9, "ta": 10, "salt": 3200}, "2026-06-02T08:00:00Z", false, now)
+	fields := []string{}
+	for _, issue := range issues {
+		if issue.Severity != IssueWarning {
+			t.Fatalf("expected warnings only, got %+v", issue)
+		}
+		fields = append(fields, issue.Field)
+	}
+	if strings.Join(fields, ",") != "ta,salt,testedAt" {
+		t.Fatalf("expected TA reagent, salt and future timestamp warnings, got %+v", issues)
+	}
+}
+
+func TestCalculateDosingBlocksOnSevereIssue(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "ph": 17, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if len(out.Doses) != 0 || out.Confidence != "Low" || len(out.ReadingIssues) != 1 {
+		t.Fatalf("expected dosing blocked, got %+v", out)
+	}
+}
+
+func TestCalculateDosingWarningLowersConfidence(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "cya": 30, "salt": 3000},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if len(out.Doses) != 1 || out.Confidence != "Low" {
+		t.Fatalf("expected dose with lowered confidence, got %s %+v", out.Confidence, out.Doses)
+	}
+}
+
+func TestBuildFallbackPlanRetestsOnSevereIssue(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("cloudy", &DiagnoseContext{LatestTest: &DiagnoseWaterTest{FC: floatPtr(1), CC: floatPtr(3), TC: floatPtr(2)}})
+	if plan.Confidence != "Low" || len(plan.ChemicalAdditions) != 0 || !strings.HasPrefix(plan.Steps[0], "Retest before adding chemicals") {
+		t.Fatalf("expected retest plan, got %+v", plan)
+	}
+}
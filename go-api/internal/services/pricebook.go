@@ -0,0 +1,266 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PriceEntry prices one product by the container it is bought in. Chemical
+// is matched as a prefix of the dose's chemical, so "liquid_chlorine" prices
+// every strength.
+type PriceEntry struct {
+	Chemical      string  `json:"chemical"`
+	ContainerSize float64 `json:"containerSize"`
+	ContainerUnit string  `json:"containerUnit"`
+	Price         float64 `json:"price"`
+}
+
+// PriceBookFile is the on-disk format: default prices, merged over the
+// builtin estimates, and per-tenant overrides, which replace the default
+// entry for the same chemical.
+type PriceBookFile struct {
+	Name     string                  `json:"name"`
+	Currency string                  `json:"currency"`
+	Default  []PriceEntry            `json:"default"`
+	Tenants  map[string][]PriceEntry `json:"tenants"`
+}
+
+type DoseCost struct {
+	Chemical string  `json:"chemical"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+	Cost     float64 `json:"cost"`
+}
+
+// CostEstimate prices a visit. Unpriced lists chemicals with no entry in
+// the price book; they are left out of the total. Maintenance is the daily
+// maintenance dose, a recurring cost that is not part of VisitTotal.
+type CostEstimate struct {
+	PriceBook   string     `json:"priceBook"`
+	Currency    string     `json:"currency"`
+	Lines       []DoseCost `json:"lines"`
+	VisitTotal  float64    `json:"visitTotal"`
+	Maintenance *DoseCost  `json:"maintenance,omitempty"`
+	Unpriced    []string   `json:"unpriced,omitempty"`
+}
+
+// builtinPriceBook holds typical US retail prices so estimates work before a
+// tenant loads its own.
+var builtinPriceBook = PriceBookFile{
+	Name:     "builtin-estimates",
+	Currency: "USD",
+	Default: []PriceEntry{
+		{"liquid_chlorine", 1, "gallons", 7},
+		{"muriatic_acid", 1, "gallons", 12},
+		{"sodium_bicarbonate", 12, "lb", 14},
+		{"sodium_carbonate", 6, "lb", 15},
+		{"sodium_tetraborate", 4, "lb", 7},
+		{"boric_acid", 25, "lb", 55},
+		{"calcium_chloride", 25, "lb", 30},
+		{"cyanuric_acid", 4, "lb", 25},
+		{"cal_hypo", 24, "lb", 90},
+		{"dichlor", 5, "lb", 35},
+		{"trichlor", 25, "lb", 110},
+		{"lithium_hypo", 1, "lb", 18},
+		{"potassium_monopersulfate", 2, "lb", 20},
+		{"sodium_bromide", 2, "lb", 25},
+		{"pool_salt", 40, "lb", 9},
+		{"phosphate_remover", 32, "floz", 30},
+		{"phosphate_remover_concentrated", 1, "liters", 65},
+		{"enzyme_clarifier", 32, "floz", 28},
+		{"metal_sequestrant", 32, "floz", 25},
+	},
+}
+
+// ozPerContainerUnit converts container units to fluid ounces (liquids) or
+// weight ounces (everything else).
+var ozPerContainerUnit = map[string]struct {
+	Oz     float64
+	Liquid bool
+}{
+	"gallons": {128, true},
+	"liters":  {1000 / mlPerFluidOz, true},
+	"ml":      {1 / mlPerFluidOz, true},
+	"floz":    {1, true},
+	"lb":      {16, false},
+	"oz":      {1, false},
+	"kg":      {1000 / gramsPerOz, false},
+	"g":       {1 / gramsPerOz, false},
+}
+
+var (
+	priceMu    sync.RWMutex
+	priceBooks = builtinPriceBook
+)
+
+// LoadPriceBooks reads and validates a price book file and replaces the
+// active price book. Its default entries are merged over the builtin ones,
+// so a partial book still prices every chemical. Nothing changes when
+// validation fails.
+func LoadPriceBooks(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var book PriceBookFile
+	if err := json.Unmarshal(data, &book); err != nil {
+		return fmt.Errorf("price book %s: %w", path, err)
+	}
+	if book.Name == "" || book.Currency == "" {
+		return fmt.Errorf("price book %s: name and currency are required", path)
+	}
+	if err := validatePriceEntries("default", book.Default); err != nil {
+		return err
+	}
+	for tenant, entries := range book.Tenants {
+		if err := validatePriceEntries("tenant "+strconv.Quote(tenant), entries); err != nil {
+			return err
+		}
+	}
+	book.Default = mergePriceEntries(builtinPriceBook.Default, book.Default)
+	priceMu.Lock()
+	priceBooks = book
+	priceMu.Unlock()
+	return nil
+}
+
+// mergePriceEntries returns base with each entry of over replacing the one
+// for the same chemical, or appended when base has none.
+func mergePriceEntries(base, over []PriceEntry) []PriceEntry {
+	merged := append([]PriceEntry{}, base...)
+	index := make(map[string]int, len(merged))
+	for i, e := range merged {
+		index[e.Chemical] = i
+	}
+	for _, e := range over {
+		if i, ok := index[e.Chemical]; ok {
+			merged[i] = e
+			continue
+		}
+		index[e.Chemical] = len(merged)
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+func validatePriceEntries(scope string, entries []PriceEntry) error {
+	for i, e := range entries {
+		unit, ok := ozPerContainerUnit[e.ContainerUnit]
+		switch {
+		case strings.TrimSpace(e.Chemical) == "":
+			return fmt.Errorf("%s entry %d: chemical is required", scope, i)
+		case !ok:
+			return fmt.Errorf("%s entry %d: unknown container unit %q", scope, i, e.ContainerUnit)
+		case unit.Liquid != isLiquidChemical(e.Chemical):
+			return fmt.Errorf("%s entry %d: %s is priced by the wrong kind of unit %q", scope, i, e.Chemical, e.ContainerUnit)
+		case e.ContainerSize <= 0 || e.Price < 0:
+			return fmt.Errorf("%s entry %d: containerSize must be positive and price not negative", scope, i)
+		}
+	}
+	return nil
+}
+
+// priceFor returns the tenant's entry for chemical, else the default's,
+// preferring the longest matching prefix.
+func priceFor(book PriceBookFile, tenant, chemical string) (PriceEntry, bool) {
+	for _, entries := range [][]PriceEntry{book.Tenants[tenant], book.Default} {
+		best, found := PriceEntry{}, false
+		for _, e := range entries {
+			if strings.HasPrefix(chemical, e.Chemical) && len(e.Chemical) > len(best.Chemical) {
+				best, found = e, true
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+	return PriceEntry{}, false
+}
+
+// doseOz converts a dose in any unit the calculator emits to fluid ounces
+// (liquids) or weight ounces.
+func doseOz(chemical string, amount float64, unit string) (float64, bool) {
+	amount, unit = measureAmount(chemical, amount, unit)
+	amount, unit = imperialAmount(amount, unit)
+	switch unit {
+	case "oz":
+		return amount, true
+	case "lb":
+		return amount * 16, true
+	case "gallons":
+		return amount * 128, true
+	}
+	for _, product := range chlorineProducts {
+		if product.OzPerUnit > 0 && unit == product.Unit && strings.HasPrefix(chemical, product.chemicalPrefix) {
+			return amount * product.OzPerUnit, true
+		}
+	}
+	return 0, false
+}
+
+// EstimateCost prices each dose with the tenant's price book.
+func EstimateCost(doses []Dose, tenant string) *CostEstimate {
+	return estimateCost(doses, nil, tenant)
+}
+
+// estimateCost prices the visit's doses and, when given, the daily
+// maintenance dose.
+func estimateCost(doses []Dose, maintenance *Dose, tenant string) *CostEstimate {
+	priceMu.RLock()
+	book := priceBooks
+	priceMu.RUnlock()
+	est := &CostEstimate{PriceBook: book.Name, Currency: book.Currency, Lines: []DoseCost{}}
+	for _, d := range doses {
+		line, ok := priceDose(book, tenant, d)
+		if !ok {
+			est.Unpriced = append(est.Unpriced, d.Chemical)
+			continue
+		}
+		est.Lines = append(est.Lines, line)
+		est.VisitTotal += line.Cost
+	}
+	est.VisitTotal = round2(est.VisitTotal)
+	if maintenance != nil {
+		if line, ok := priceDose(book, tenant, *maintenance); ok {
+			est.Maintenance = &line
+		} else {
+			est.Unpriced = append(est.Unpriced, maintenance.Chemical)
+		}
+	}
+	sort.Strings(est.Unpriced)
+	return est
+}
+
+func priceDose(book PriceBookFile, tenant string, d Dose) (DoseCost, bool) {
+	entry, ok := priceFor(book, tenant, d.Chemical)
+	oz, converted := doseOz(d.Chemical, d.Amount, d.Unit)
+	if !ok || !converted {
+		return DoseCost{}, false
+	}
+	cost := round2(oz / (entry.ContainerSize * ozPerContainerUnit[entry.ContainerUnit].Oz) * entry.Price)
+	return DoseCost{d.Chemical, d.Amount, d.Unit, cost}, true
+}
+
+// PlanCost prices a diagnose plan's chemical additions. Additions whose
+// amount is not a number are reported as unpriced.
+func PlanCost(plan DiagnosePlan, tenant string) *CostEstimate {
+	doses := make([]Dose, 0, len(plan.ChemicalAdditions))
+	var unparsed []string
+	for _, a := range plan.ChemicalAdditions {
+		amount, err := strconv.ParseFloat(strings.TrimSpace(a["amount"]), 64)
+		if err != nil {
+			unparsed = append(unparsed, a["chemical"])
+			continue
+		}
+		doses = append(doses, Dose{a["chemical"], amount, a["unit"], "", ""})
+	}
+	est := EstimateCost(doses, tenant)
+	est.Unpriced = append(est.Unpriced, unparsed...)
+	sort.Strings(est.Unpriced)
+	return est
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadTestPriceBook(t *testing.T, body string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { priceBooks = builtinPriceBook })
+	return LoadPriceBooks(path)
+}
+
+func TestCalculateDosingEstimatesCost(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "ta": 70, "cya": 30},
+		Targets:           map[string]float64{"fc": 4, "ta": 80},
+	})
+	if out.Cost == nil || out.Cost.PriceBook != "builtin-estimates" || len(out.Cost.Lines) != 2 {
+		t.Fatalf("expected builtin cost lines, got %+v", out.Cost)
+	}
+	// 38.4 oz of a $7 gallon and 1.4 lb of a $14 12 lb bag.
+	if out.Cost.Lines[0].Cost != 2.1 || out.Cost.Lines[1].Cost != 1.63 || out.Cost.VisitTotal != 3.73 {
+		t.Fatalf("unexpected costs: %+v", out.Cost)
+	}
+}
+
+func TestEstimateCostTenantOverridesAndUnits(t *testing.T) {
+	data, err := os.ReadFile("../../rules/price-book.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestPriceBook(t, string(data)); err != nil {
+		t.Fatalf("example price book should load: %v", err)
+	}
+	doses := []Dose{
+		{"liquid_chlorine_10pct", 1, "gallons", "", ""},
+		{"muriatic_acid_31_45pct", 3785.4, "ml", "", ""},
+		{"trichlor_90pct", 2, "tablets", "", ""},
+		{"mystery_clarifier", 4, "oz", "", ""},
+	}
+	// Trichlor is not in the example book, so it keeps the builtin price.
+	def := EstimateCost(doses, "")
+	if def.Lines[0].Cost != 5.8 || def.Lines[1].Cost != 11 || def.Lines[2].Cost != 4.4 || len(def.Unpriced) != 1 || def.Unpriced[0] != "mystery_clarifier" {
+		t.Fatalf("unexpected default estimate: %+v", def)
+	}
+	if acme := EstimateCost(doses, "acme-pools"); acme.Lines[0].Cost != 4 {
+		t.Fatalf("expected tenant chlorine price, got %+v", acme)
+	}
+}
+
+func TestCalculateDosingPricesMaintenanceDose(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 4, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+		DailyFCDemand:     2,
+	})
+	// 25.6 oz a day of a $7 gallon, kept out of the visit total.
+	if out.Cost == nil || out.Cost.Maintenance == nil || out.Cost.Maintenance.Cost != 1.4 || out.Cost.VisitTotal != 0 {
+		t.Fatalf("expected priced maintenance dose, got %+v", out.Cost)
+	}
+}
+
+func TestLoadPriceBooksRejectsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"no currency":  `{"name":"x","default":[]}`,
+		"unknown unit": `{"name":"x","currency":"USD","default":[{"chemical":"pool_salt","containerSize":40,"containerUnit":"bag","price":8}]}`,
+		"wrong kind":   `{"name":"x","currency":"USD","default":[{"chemical":"muriatic_acid","containerSize":1,"containerUnit":"lb","price":8}]}`,
+		"bad tenant":   `{"name":"x","currency":"USD","tenants":{"t":[{"chemical":"pool_salt","containerSize":0,"containerUnit":"lb","price":8}]}}`,
+	}
+	for name, body := range cases {
+		if err := loadTestPriceBook(t, body); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestBuildFallbackPlanEstimatesCost(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("cloudy", nil)
+	if plan.EstimatedCost == nil || plan.EstimatedCost.VisitTotal != 3.5 {
+		t.Fatalf("expected 64 oz of $7/gal chlorine, got %+v", plan.EstimatedCost)
+	}
+}
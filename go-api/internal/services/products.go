@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ChlorineProduct is one sanitizer in the catalog. CYAPerPPM and CHPerPPM are
+// the stabilizer and calcium each 1 ppm of FC from the product leaves behind.
+type ChlorineProduct struct {
+	Key            string  `json:"key"`
+	Name           string  `json:"name"`
+	Form           string  `json:"form"`
+	DefaultPercent float64 `json:"defaultPercent"`
+	StrengthKey    string  `json:"strengthKey"`
+	Unit           string  `json:"unit"`
+	CapOz          float64 `json:"capOz"`
+	OzPerUnit      float64 `json:"ozPerUnit,omitempty"`
+	CYAPerPPM      float64 `json:"cyaPerPpm"`
+	CHPerPPM       float64 `json:"chPerPpm"`
+	chemicalPrefix string
+	notes          string
+}
+
+const defaultChlorineProduct = "liquid_chlorine"
+
+// Side-effect thresholds for the projected CYA and CH after a chlorine dose.
+const (
+	cyaWarnAbove     = 50
+	cyaWarnAboveSalt = 80
+	chWarnAbove      = 400
+)
+
+// dryOzPerPPMPer10k is the weight of 100% available chlorine that raises
+// 10k gallons by 1 ppm FC.
+const dryOzPerPPMPer10k = 1.335
+
+var chlorineProducts = map[string]ChlorineProduct{
+	"liquid_chlorine": {Key: "liquid_chlorine", Name: "Liquid chlorine (sodium hypochlorite)", Form: "liquid", DefaultPercent: 10, StrengthKey: "liquidChlorinePercent", Unit: "oz", CapOz: liquidChlorineCapOz,
+		chemicalPrefix: "liquid_chlorine", notes: "Add half dose, circulate 30-60 min, retest before adding remainder."},
+	"cal_hypo": {Key: "cal_hypo", Name: "Calcium hypochlorite", Form: "granular", DefaultPercent: 65, StrengthKey: "calHypoPercent", Unit: "oz", CapOz: 80, CHPerPPM: 0.7,
+		chemicalPrefix: "cal_hypo", notes: "Pre-dissolve in a bucket of pool water; add half, circulate, retest. Raises calcium hardness."},
+	"dichlor": {Key: "dichlor", Name: "Sodium dichlor", Form: "granular", DefaultPercent: 56, StrengthKey: "dichlorPercent", Unit: "oz", CapOz: 48, CYAPerPPM: 0.9,
+		chemicalPrefix: "dichlor", notes: "Broadcast with pump running; add half, circulate, retest. Raises CYA."},
+	"trichlor": {Key: "trichlor", Name: "Trichlor tablets", Form: "tablet", DefaultPercent: 90, StrengthKey: "trichlorPercent", Unit: "tablets", CapOz: 32, OzPerUnit: 8, CYAPerPPM: 0.6,
+		chemicalPrefix: "trichlor", notes: "Load %s in a feeder or floater and let it dissolve over several days; never broadcast or drop in the skimmer. Lowers pH and raises CYA."},
+	"lithium_hypo": {Key: "lithium_hypo", Name: "Lithium hypochlorite", Form: "granular", DefaultPercent: 35, StrengthKey: "lithiumHypoPercent", Unit: "oz", CapOz: 64,
+		chemicalPrefix: "lithium_hypo", notes: "Broadcast with pump running; add half, circulate, retest."},
+}
+
+// ChlorineProducts lists the catalog in a stable order for the API.
+func ChlorineProducts() []ChlorineProduct {
+	out := make([]ChlorineProduct, 0, len(chlorineProducts))
+	for _, p := range chlorineProducts {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// chlorineDose converts an FC increase into the selected product's units and
+// warns when the product's by-products push CYA or CH past a threshold.
+func chlorineDose(in CalcInput, pool, delta float64) (Dose, []string, []string) {
+	var assumptions, warnings []string
+	key := in.Products["chlorine"]
+	product, ok := chlorineProducts[key]
+	if !ok {
+		if key != "" {
+			assumptions = append(assumptions, "Unknown chlorine product "+strconv.Quote(key)+"; dosed as liquid chlorine.")
+		}
+		product = chlorineProducts[defaultChlorineProduct]
+	}
+	capOz := product.CapOz
+	percent := in.ProductStrengths[product.StrengthKey]
+	if product.Key == defaultChlorineProduct {
+		capOz = in.ruleSet().LiquidChlorineCapOz
+		if percent == 0 {
+			percent = in.ruleSet().LiquidChlorinePercent
+		}
+	}
+	if percent == 0 {
+		percent = product.DefaultPercent
+	}
+	chemical := product.chemicalPrefix + "_" + strconv.FormatFloat(percent, 'f', -1, 64) + "pct"
+
+	raw := delta * (pool / 10000) * dryOzPerPPMPer10k * 100 / percent
+	if product.Form == "liquid" {
+		raw = ((delta * pool) / (10000 * percent)) * 128
+	}
+	oz := cappedDose(raw, doseCap(in, pool, capOz), chemical, "oz", &assumptions)
+	amount, notes := oz, product.notes
+	if product.OzPerUnit > 0 {
+		// Tablets are loaded whole and dissolve over days, so the dose is a
+		// feeder load rather than an immediate FC increase.
+		amount = math.Max(1, math.Round(oz/product.OzPerUnit))
+		notes = fmt.Sprintf(notes, tabletCount(amount))
+	}
+	dose := Dose{chemical, amount, product.Unit, notes, ""}
+
+	if product.CYAPerPPM > 0 {
+		limit := float64(cyaWarnAbove)
+		if isSaltPool(in) {
+			limit = cyaWarnAboveSalt
+		}
+		rise := delta * product.CYAPerPPM
+		if cya, ok := in.Readings["cya"]; !ok {
+			warnings = append(warnings, fmt.Sprintf("%s will raise CYA by about %.0f ppm; CYA was not tested, so confirm it stays at or below %.0f.", product.Name, rise, limit))
+		} else if projected := cya + rise; projected > limit {
+			warnings = append(warnings, fmt.Sprintf("%s will raise CYA from %.0f to about %.0f ppm (above %.0f); switch to liquid chlorine or cal-hypo.", product.Name, cya, projected, limit))
+		}
+	}
+	if product.CHPerPPM > 0 {
+		rise := delta * product.CHPerPPM
+		if ch, ok := in.Readings["ch"]; !ok {
+			warnings = append(warnings, fmt.Sprintf("%s will raise calcium hardness by about %.0f ppm; CH was not tested, so confirm it stays at or below %d.", product.Name, rise, chWarnAbove))
+		} else if projected := ch + rise; projected > chWarnAbove {
+			warnings = append(warnings, fmt.Sprintf("%s will raise calcium hardness from %.0f to about %.0f ppm (above %d); watch for scaling.", product.Name, ch, projected, chWarnAbove))
+		}
+	}
+	return dose, assumptions, warnings
+}
+
+func tabletCount(n float64) string {
+	if n == 1 {
+		return "1 tablet"
+	}
+	return fmt.Sprintf("%.0f tablets", n)
+}
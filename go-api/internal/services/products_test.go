@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChlorineDoseCalHypo(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "cya": 30, "ch": 399},
+		Targets:           map[string]float64{"fc": 4},
+		Products:          map[string]string{"chlorine": "cal_hypo"},
+	})
+	if out.Doses[0].Chemical != "cal_hypo_65pct" || out.Doses[0].Amount != 6.2 {
+		t.Fatalf("unexpected cal-hypo dose: %+v", out.Doses[0])
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "calcium hardness") {
+		t.Fatalf("expected calcium warning, got %v", out.Warnings)
+	}
+}
+
+func TestChlorineDoseDichlorWarnsOnCYA(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 0, "cya": 40},
+		Targets:           map[string]float64{"fc": 15},
+		Products:          map[string]string{"chlorine": "dichlor"},
+	})
+	if out.Doses[0].Amount != 35.8 {
+		t.Fatalf("unexpected dichlor dose: %+v", out.Doses[0])
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "CYA from 40 to about 54") {
+		t.Fatalf("expected CYA warning, got %v", out.Warnings)
+	}
+}
+
+func TestChlorineDoseTrichlorInTablets(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 3},
+		Products:          map[string]string{"chlorine": "trichlor"},
+	})
+	if out.Doses[0].Unit != "tablets" || out.Doses[0].Amount != 1 || !strings.HasPrefix(out.Doses[0].Notes, "Load 1 tablet in a feeder") {
+		t.Fatalf("unexpected trichlor dose: %+v", out.Doses[0])
+	}
+}
+
+func TestChlorineDoseWarnsWithoutReading(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+		Products:          map[string]string{"chlorine": "cal_hypo"},
+	})
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "calcium hardness by about 2 ppm") {
+		t.Fatalf("expected untested CH warning, got %v", out.Warnings)
+	}
+	out = CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 0},
+		Targets:           map[string]float64{"fc": 15},
+		Products:          map[string]string{"chlorine": "dichlor"},
+	})
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "CYA by about 14 ppm") {
+		t.Fatalf("expected untested CYA warning, got %v", out.Warnings)
+	}
+}
+
+func TestChlorineProductsCatalog(t *testing.T) {
+	products := ChlorineProducts()
+	if len(products) != 5 || products[0].Key != "cal_hypo" {
+		t.Fatalf("unexpected catalog: %+v", products)
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// TargetProfile is the named set of target ranges for a surface and
+// sanitizer, e.g. "vinyl/salt". Spas and swim spas replace the surface.
+type TargetProfile struct {
+	Name   string                 `json:"name"`
+	Ranges map[string]TargetRange `json:"ranges"`
+}
+
+// surfaceRanges: plaster needs more calcium to avoid etching; vinyl and
+// fiberglass run lower CH to avoid scale and staining.
+var surfaceRanges = map[string]map[string]TargetRange{
+	"plaster": {
+		"ph": {7.2, 7.5, 7.8},
+		"ta": {70, 80, 100},
+		"ch": {250, 350, 450},
+	},
+	"vinyl": {
+		"ph": {7.2, 7.5, 7.8},
+		"ta": {60, 80, 100},
+		"ch": {150, 200, 300},
+	},
+	"fiberglass": {
+		"ph": {7.2, 7.5, 7.8},
+		"ta": {60, 80, 100},
+		"ch": {150, 200, 250},
+	},
+}
+
+// surfaceAliases map finishes onto the surface family they behave like.
+var surfaceAliases = map[string]string{
+	"pebble":    "plaster",
+	"quartz":    "plaster",
+	"aggregate": "plaster",
+	"gunite":    "plaster",
+	"shotcrete": "plaster",
+	"concrete":  "plaster",
+	"liner":     "vinyl",
+	"acrylic":   "fiberglass",
+}
+
+const defaultSurface = "plaster"
+
+// sanitizerRanges: salt pools run higher CYA and lower TA to slow the pH
+// rise from the cell; bromine is not stabilized by CYA.
+var sanitizerRanges = map[string]map[string]TargetRange{
+	"chlorine": {
+		"cya": {30, 40, 50},
+	},
+	"salt": {
+		"ta":  {60, 70, 80},
+		"cya": {60, 70, 80},
+	},
+	"bromine": {
+		"br": {bromineMinimum, bromineTarget, bromineMaximum},
+	},
+}
+
+// profileFilledKeys are filled from ranges when the reading is outside
+// them; FC, bromine and salt have their own fill rules.
+var profileFilledKeys = []string{"ph", "ta", "ch", "cya", "phosphates"}
+
+var readingLabels = map[string]string{"ph": "pH", "ta": "TA", "ch": "CH", "cya": "CYA", "phosphates": "Phosphates"}
+
+func resolveSurface(value string) (string, bool) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	if alias, ok := surfaceAliases[s]; ok {
+		s = alias
+	}
+	_, ok := surfaceRanges[s]
+	return s, ok
+}
+
+func sanitizerFamily(in CalcInput) string {
+	switch {
+	case isBromine(in.SanitizerType):
+		return "bromine"
+	case isSaltPool(in):
+		return "salt"
+	default:
+		return "chlorine"
+	}
+}
+
+// targetProfile builds the profile for the input's surface, sanitizer and
+// body of water. Sanitizer ranges override the surface, and spa ranges
+// override both.
+func targetProfile(in CalcInput, out *CalcOutput) TargetProfile {
+	surface, ok := resolveSurface(in.SurfaceType)
+	if !ok {
+		if strings.TrimSpace(in.SurfaceType) != "" {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown surface type %q; using %s ranges.", in.SurfaceType, defaultSurface))
+		}
+		surface = defaultSurface
+	}
+	sanitizer := sanitizerFamily(in)
+	name := surface
+	body := waterBodyProfiles[in.BodyOfWater]
+	if in.BodyOfWater != "" && in.BodyOfWater != BodyPool {
+		name = in.BodyOfWater
+	}
+
+	ranges := map[string]TargetRange{}
+	for _, layer := range []map[string]TargetRange{surfaceRanges[surface], sanitizerRanges[sanitizer], body.Ranges} {
+		for key, r := range layer {
+			ranges[key] = r
+		}
+	}
+	ranges["phosphates"] = TargetRange{0, phosphateTarget, phosphateAction}
+	if sanitizer == "salt" {
+		spec := saltGeneratorSpec(in)
+		ranges["salt"] = TargetRange{spec.IdealMin, math.Round((spec.IdealMin+spec.IdealMax)/2/100) * 100, spec.IdealMax}
+	}
+	return TargetProfile{Name: name + "/" + sanitizer, Ranges: ranges}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingAppliesProfileWhenTargetsMissing(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		SurfaceType:       "vinyl",
+		IsSalt:            true,
+		Readings:          map[string]float64{"fc": 3, "ph": 7.5, "ta": 95, "ch": 220, "cya": 40, "salt": 2900},
+	})
+	if out.TargetProfile != "vinyl/salt" {
+		t.Fatalf("expected vinyl/salt profile, got %s", out.TargetProfile)
+	}
+	if out.TargetRanges["ta"].Max != 80 || out.TargetRanges["ch"].Max != 300 {
+		t.Fatalf("expected salt TA and vinyl CH ranges, got %+v", out.TargetRanges)
+	}
+	chemicals := []string{}
+	for _, d := range out.Doses {
+		chemicals = append(chemicals, d.Chemical)
+	}
+	// TA 95 is above the salt range (no lowering dose); CYA 40 is below it.
+	if strings.Join(chemicals, ",") != "cyanuric_acid,pool_salt" {
+		t.Fatalf("expected CYA and salt doses from the profile, got %+v", out.Doses)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "outside the vinyl/salt range 60-80") {
+		t.Fatalf("expected profile assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestCalculateDosingExplicitTargetsOverrideProfile(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		SurfaceType:       "plaster",
+		Readings:          map[string]float64{"fc": 3, "ph": 8.0, "cya": 30},
+		Targets:           map[string]float64{"fc": 3, "ph": 7.8},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Amount != 2.2 || out.TargetProfile != "plaster/chlorine" {
+		t.Fatalf("expected acid to the explicit pH target, got %s %+v", out.TargetProfile, out.Doses)
+	}
+}
+
+func TestCalculateDosingFillsOnlyMissingTargets(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 3, "ph": 8.0, "ch": 100, "cya": 40},
+		Targets:           map[string]float64{"fc": 3},
+	})
+	chemicals := []string{}
+	for _, d := range out.Doses {
+		chemicals = append(chemicals, d.Chemical)
+	}
+	// No surface type falls back to plaster: pH 8.0 and CH 100 are outside it.
+	if strings.Join(chemicals, ",") != "muriatic_acid_31_45pct,calcium_chloride" || out.TargetProfile != "plaster/chlorine" {
+		t.Fatalf("expected plaster profile to fill pH and CH, got %s %+v", out.TargetProfile, out.Doses)
+	}
+}
+
+func TestTargetProfileSpaAndAliases(t *testing.T) {
+	out := &CalcOutput{}
+	spa := targetProfile(CalcInput{BodyOfWater: BodySpa, SanitizerType: "bromine", SurfaceType: "acrylic"}, out)
+	if spa.Name != "spa/bromine" || spa.Ranges["br"].Target != 5 || spa.Ranges["ch"].Max != 250 {
+		t.Fatalf("expected spa ranges to override, got %+v", spa)
+	}
+	pebble := targetProfile(CalcInput{SurfaceType: "Pebble"}, out)
+	if pebble.Name != "plaster/chlorine" || len(out.Assumptions) != 0 {
+		t.Fatalf("expected pebble to map to plaster, got %+v %v", pebble, out.Assumptions)
+	}
+	targetProfile(CalcInput{SurfaceType: "marble dust"}, out)
+	if len(out.Assumptions) != 1 {
+		t.Fatalf("expected unknown surface assumption, got %v", out.Assumptions)
+	}
+}
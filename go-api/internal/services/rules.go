@@ -0,0 +1,173 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RuleSet holds the tunable dosing constants. Version is returned with every
+// plan so it can be traced back to the exact rules that produced it.
+type RuleSet struct {
+	Version                 string  `json:"version"`
+	AcidOzPer10kPerPH       float64 `json:"acidOzPer10kPerPH"`
+	AcidCapOz               float64 `json:"acidCapOz"`
+	BicarbLbPer10PPMPer10k  float64 `json:"bicarbLbPer10PPMPer10k"`
+	BicarbCapLb             float64 `json:"bicarbCapLb"`
+	CalciumLbPer10PPMPer10k float64 `json:"calciumLbPer10PPMPer10k"`
+	CalciumCapLb            float64 `json:"calciumCapLb"`
+	CYAOzPer10PPMPer10k     float64 `json:"cyaOzPer10PPMPer10k"`
+	CYACapOz                float64 `json:"cyaCapOz"`
+	DefaultTA               float64 `json:"defaultTA"`
+	LiquidChlorineCapOz     float64 `json:"liquidChlorineCapOz"`
+	LiquidChlorinePercent   float64 `json:"liquidChlorinePercent"`
+	RetestHours             int     `json:"retestHours"`
+}
+
+// BuiltinRuleSetVersion names the compiled-in rules the golden vectors are
+// written against.
+const BuiltinRuleSetVersion = "builtin-1"
+
+var builtinRuleSet = RuleSet{
+	Version:                 BuiltinRuleSetVersion,
+	AcidOzPer10kPerPH:       acidOzPer10kPerPH,
+	AcidCapOz:               64,
+	BicarbLbPer10PPMPer10k:  bicarbLbPer10PPMPer10k,
+	BicarbCapLb:             25,
+	CalciumLbPer10PPMPer10k: calciumLbPer10PPMPer10k,
+	CalciumCapLb:            30,
+	CYAOzPer10PPMPer10k:     cyaOzPer10PPMPer10k,
+	CYACapOz:                128,
+	DefaultTA:               defaultTA,
+	LiquidChlorineCapOz:     liquidChlorineCapOz,
+	LiquidChlorinePercent:   10,
+	RetestHours:             4,
+}
+
+// RuleSetFile is the on-disk format: the rule sets, the default version and
+// per-tenant overrides. Fields a rule set leaves out inherit the builtin
+// values.
+type RuleSetFile struct {
+	Default  string            `json:"default"`
+	Tenants  map[string]string `json:"tenants"`
+	RuleSets []json.RawMessage `json:"ruleSets"`
+}
+
+type ruleRegistry struct {
+	sets          map[string]RuleSet
+	defaultVer    string
+	tenantVersion map[string]string
+}
+
+var (
+	rulesMu     sync.RWMutex
+	activeRules = builtinRegistry()
+)
+
+func builtinRegistry() ruleRegistry {
+	return ruleRegistry{
+		sets:          map[string]RuleSet{BuiltinRuleSetVersion: builtinRuleSet},
+		defaultVer:    BuiltinRuleSetVersion,
+		tenantVersion: map[string]string{},
+	}
+}
+
+// LoadRuleSets reads a rule set file, validates every rule set and tenant
+// mapping, and replaces the active registry. The builtin rules stay
+// selectable by version. Nothing changes when validation fails.
+func LoadRuleSets(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file RuleSetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("rule set file %s: %w", path, err)
+	}
+	reg := builtinRegistry()
+	for i, raw := range file.RuleSets {
+		set := builtinRuleSet
+		set.Version = ""
+		if err := json.Unmarshal(raw, &set); err != nil {
+			return fmt.Errorf("rule set %d: %w", i, err)
+		}
+		if err := validateRuleSet(set); err != nil {
+			return fmt.Errorf("rule set %d: %w", i, err)
+		}
+		if _, dup := reg.sets[set.Version]; dup {
+			return fmt.Errorf("rule set %d: duplicate version %q", i, set.Version)
+		}
+		reg.sets[set.Version] = set
+	}
+	if file.Default != "" {
+		if _, ok := reg.sets[file.Default]; !ok {
+			return fmt.Errorf("default rule set %q is not defined", file.Default)
+		}
+		reg.defaultVer = file.Default
+	}
+	for tenant, version := range file.Tenants {
+		if _, ok := reg.sets[version]; !ok {
+			return fmt.Errorf("tenant %q uses undefined rule set %q", tenant, version)
+		}
+		reg.tenantVersion[tenant] = version
+	}
+	rulesMu.Lock()
+	activeRules = reg
+	rulesMu.Unlock()
+	return nil
+}
+
+func validateRuleSet(set RuleSet) error {
+	if set.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	for name, v := range map[string]float64{
+		"acidOzPer10kPerPH":       set.AcidOzPer10kPerPH,
+		"acidCapOz":               set.AcidCapOz,
+		"bicarbLbPer10PPMPer10k":  set.BicarbLbPer10PPMPer10k,
+		"bicarbCapLb":             set.BicarbCapLb,
+		"calciumLbPer10PPMPer10k": set.CalciumLbPer10PPMPer10k,
+		"calciumCapLb":            set.CalciumCapLb,
+		"cyaOzPer10PPMPer10k":     set.CYAOzPer10PPMPer10k,
+		"cyaCapOz":                set.CYACapOz,
+		"defaultTA":               set.DefaultTA,
+		"liquidChlorineCapOz":     set.LiquidChlorineCapOz,
+		"liquidChlorinePercent":   set.LiquidChlorinePercent,
+		"retestHours":             float64(set.RetestHours),
+	} {
+		if v <= 0 {
+			return fmt.Errorf("%s: %s must be positive", set.Version, name)
+		}
+	}
+	if set.LiquidChlorinePercent > 100 {
+		return fmt.Errorf("%s: liquidChlorinePercent must be at most 100", set.Version)
+	}
+	return nil
+}
+
+// resolveRuleSet picks the requested version, else the tenant's, else the
+// default. An unknown version falls back with an explanation.
+func resolveRuleSet(version, tenant string) (RuleSet, error) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	if version != "" {
+		if set, ok := activeRules.sets[version]; ok {
+			return set, nil
+		}
+		return activeRules.sets[activeRules.defaultVer], fmt.Errorf("rule set %q is not defined", version)
+	}
+	if v, ok := activeRules.tenantVersion[tenant]; ok && tenant != "" {
+		return activeRules.sets[v], nil
+	}
+	return activeRules.sets[activeRules.defaultVer], nil
+}
+
+// ruleSet returns the rules resolved for this calculation, or the builtin
+// rules for inputs built internally.
+func (in CalcInput) ruleSet() RuleSet {
+	if in.rules != nil {
+		return *in.rules
+	}
+	return builtinRuleSet
+}
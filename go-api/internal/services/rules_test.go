@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestRuleSets(t *testing.T, body string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { activeRules = builtinRegistry() })
+	return LoadRuleSets(path)
+}
+
+func TestLoadRuleSetsExample(t *testing.T) {
+	data, err := os.ReadFile("../../rules/dosing-rules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestRuleSets(t, string(data)); err != nil {
+		t.Fatalf("example rule sets should load: %v", err)
+	}
+	in := CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 0, "cya": 30},
+		Targets:           map[string]float64{"fc": 40},
+	}
+	out := CalculateDosing(in)
+	if out.RuleSetVersion != "2026.1" || out.Doses[0].Amount != 512 {
+		t.Fatalf("expected default rule set with builtin values, got %s %+v", out.RuleSetVersion, out.Doses)
+	}
+	in.Tenant = "acme-pools"
+	out = CalculateDosing(in)
+	if out.RuleSetVersion != "2026.1-conservative" || out.RetestHours != 6 || out.Doses[0].Chemical != "liquid_chlorine_8pct" || out.Doses[0].Amount != 384 {
+		t.Fatalf("expected tenant rule set, got %s %d %+v", out.RuleSetVersion, out.RetestHours, out.Doses)
+	}
+	in.RuleSet = BuiltinRuleSetVersion
+	if out = CalculateDosing(in); out.RuleSetVersion != BuiltinRuleSetVersion {
+		t.Fatalf("expected request version to win over tenant, got %s", out.RuleSetVersion)
+	}
+}
+
+func TestLoadRuleSetsRejectsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"missing version": `{"ruleSets":[{"acidCapOz":10}]}`,
+		"non-positive":    `{"ruleSets":[{"version":"a","bicarbCapLb":0}]}`,
+		"duplicate":       `{"ruleSets":[{"version":"a"},{"version":"a"}]}`,
+		"unknown default": `{"default":"b","ruleSets":[{"version":"a"}]}`,
+		"unknown tenant":  `{"tenants":{"t":"b"},"ruleSets":[{"version":"a"}]}`,
+	}
+	for name, body := range cases {
+		if err := loadTestRuleSets(t, body); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if v := CalculateDosing(CalcInput{PoolVolumeGallons: 10000}).RuleSetVersion; v != BuiltinRuleSetVersion {
+		t.Fatalf("failed loads must leave the registry unchanged, got %s", v)
+	}
+}
+
+func TestCalculateDosingUnknownRuleSet(t *testing.T) {
+	out := CalculateDosing(CalcInput{PoolVolumeGallons: 10000, RuleSet: "nope", Readings: map[string]float64{"cya": 30}})
+	if out.RuleSetVersion != BuiltinRuleSetVersion || !strings.Contains(strings.Join(out.Assumptions, " "), `rule set "nope" is not defined`) {
+		t.Fatalf("expected fallback to builtin, got %s %v", out.RuleSetVersion, out.Assumptions)
+	}
+}
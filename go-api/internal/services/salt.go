@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SaltGenerator describes the installed chlorine generator. RatedLbPerDay is
+// the cell's chlorine output at 100% running 24 hours.
+type SaltGenerator struct {
+	IdealMin      float64 `json:"idealMin,omitempty"`
+	IdealMax      float64 `json:"idealMax,omitempty"`
+	RatedLbPerDay float64 `json:"ratedLbPerDay,omitempty"`
+	PumpHours     float64 `json:"pumpHours,omitempty"`
+	BagLb         float64 `json:"bagLb,omitempty"`
+}
+
+type SaltGeneratorGuidance struct {
+	IdealMin      float64  `json:"idealMin"`
+	IdealMax      float64  `json:"idealMax"`
+	OutputPercent *float64 `json:"outputPercent,omitempty"`
+	PumpHours     float64  `json:"pumpHours"`
+	Notes         []string `json:"notes"`
+}
+
+const (
+	defaultSaltIdealMin  = 2700
+	defaultSaltIdealMax  = 3400
+	defaultSaltPumpHours = 8
+	defaultSaltBagLb     = 40
+	// lbPerPPMGallon converts ppm x gallons into pounds of dissolved solid.
+	lbPerPPMGallon = 8.34e-6
+)
+
+func isSaltPool(in CalcInput) bool {
+	return in.IsSalt || strings.EqualFold(strings.TrimSpace(in.SanitizerType), "salt")
+}
+
+func saltGeneratorSpec(in CalcInput) SaltGenerator {
+	spec := SaltGenerator{}
+	if in.SaltGenerator != nil {
+		spec = *in.SaltGenerator
+	}
+	if spec.IdealMin <= 0 {
+		spec.IdealMin = defaultSaltIdealMin
+	}
+	if spec.IdealMax <= 0 {
+		spec.IdealMax = defaultSaltIdealMax
+	}
+	if spec.PumpHours <= 0 {
+		spec.PumpHours = defaultSaltPumpHours
+	}
+	if spec.BagLb <= 0 {
+		spec.BagLb = defaultSaltBagLb
+	}
+	return spec
+}
+
+// saltDose sizes pool salt in pounds and whole bags. Bags round down so the
+// first addition never overshoots; the remainder is added after retesting.
+func saltDose(spec SaltGenerator, pool, reading, target float64) (Dose, []string) {
+	var warnings []string
+	if target < spec.IdealMin || target > spec.IdealMax {
+		warnings = append(warnings, fmt.Sprintf("Salt target %.0f ppm is outside the generator's %.0f-%.0f ppm range.", target, spec.IdealMin, spec.IdealMax))
+	}
+	lbs := (target - reading) * pool * lbPerPPMGallon
+	bags := math.Floor(lbs / spec.BagLb)
+	notes := fmt.Sprintf("About %.0f x %.0f lb bags. Broadcast in the deep end with the generator off, brush, circulate 24h and retest before adding more.", bags, spec.BagLb)
+	if bags < 1 {
+		notes = "Less than one bag; weigh out the amount. Broadcast with the generator off, brush, circulate 24h and retest."
+	}
+	return Dose{"pool_salt", lbs, "lb", notes, ""}, warnings
+}
+
+// saltGeneratorGuidance estimates the output percentage that replaces the
+// daily chlorine demand within the configured pump run time.
+func saltGeneratorGuidance(in CalcInput, spec SaltGenerator, pool float64, out *CalcOutput) *SaltGeneratorGuidance {
+	g := &SaltGeneratorGuidance{IdealMin: spec.IdealMin, IdealMax: spec.IdealMax, PumpHours: spec.PumpHours, Notes: []string{}}
+	if salt, ok := in.Readings["salt"]; ok {
+		switch {
+		case salt < spec.IdealMin:
+			g.Notes = append(g.Notes, fmt.Sprintf("Salt %.0f ppm is below the %.0f ppm minimum; the cell will under-produce or shut down.", salt, spec.IdealMin))
+		case salt > spec.IdealMax:
+			g.Notes = append(g.Notes, fmt.Sprintf("Salt %.0f ppm is above the %.0f ppm maximum; dilute to protect the cell.", salt, spec.IdealMax))
+		}
+	}
+	demand := in.DailyFCDemand
+	if demand <= 0 {
+		out.Assumptions = append(out.Assumptions, "Daily FC demand not provided; generator output not estimated.")
+		return g
+	}
+	if spec.RatedLbPerDay <= 0 {
+		// Only the output estimate depends on the rating; the chemical
+		// doses stand on their own.
+		g.Notes = append(g.Notes, "Generator rating (saltGenerator.ratedLbPerDay) not provided; output not estimated.")
+		return g
+	}
+	needLb := demand * pool * lbPerPPMGallon
+	percent := needLb / (spec.RatedLbPerDay * spec.PumpHours / 24) * 100
+	rounded := math.Min(math.Ceil(percent/5)*5, 100)
+	g.OutputPercent = &rounded
+	if percent > 100 {
+		g.Notes = append(g.Notes, fmt.Sprintf("Demand needs %.0f%% output; extend pump hours, supplement with liquid chlorine, or the cell is undersized.", percent))
+	}
+	return g
+}
+
+// saltCellFallbackSteps adds salt-cell checks to the fallback diagnosis for
+// salt pools: low chlorine output and scaled cells are the usual culprits.
+func saltCellFallbackSteps(symptoms string, context *DiagnoseContext) []string {
+	if context == nil {
+		return nil
+	}
+	salt := context.IsSalt != nil && *context.IsSalt || strings.EqualFold(strings.TrimSpace(context.SanitizerType), "salt")
+	if !salt {
+		return nil
+	}
+	var steps []string
+	text := strings.ToLower(symptoms)
+	lowOutput := strings.Contains(text, "low output") || strings.Contains(text, "no chlorine") || strings.Contains(text, "check cell") || strings.Contains(text, "not producing")
+	scaling := strings.Contains(text, "scale") || strings.Contains(text, "white flakes") || strings.Contains(text, "crust")
+	test := context.LatestTest
+	if test != nil && test.FC != nil && *test.FC < 2 {
+		lowOutput = true
+	}
+	if test != nil && test.Salt != nil {
+		switch {
+		case *test.Salt < defaultSaltIdealMin:
+			steps = append(steps, fmt.Sprintf("Salt is %.0f ppm, below the generator range; add salt before raising output", *test.Salt))
+		case *test.Salt > defaultSaltIdealMax:
+			steps = append(steps, fmt.Sprintf("Salt is %.0f ppm, above the generator range; partially drain to protect the cell", *test.Salt))
+		}
+	}
+	if lowOutput {
+		steps = append(steps,
+			"Compare the generator's salt display with a drop/strip salt test",
+			"Check flow switch, cell connections and that the cell is not in low-temperature cutoff",
+			"Raise generator output or pump run time, supplementing with liquid chlorine until FC recovers",
+		)
+	}
+	if scaling {
+		steps = append(steps, "Inspect the salt cell for white scale; if scaled, clean with a mild acid solution per manufacturer and check pH/CSI")
+	} else if test != nil && test.PH != nil && *test.PH > 7.8 {
+		steps = append(steps, "High pH scales salt cells; inspect the cell plates")
+	}
+	return steps
+}
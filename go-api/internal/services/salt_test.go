@@ -0,0 +1,110 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingSaltBags(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		IsSalt:            true,
+		Readings:          map[string]float64{"salt": 2400, "cya": 70},
+		Targets:           map[string]float64{"salt": 3200},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "pool_salt" || out.Doses[0].Amount != 100.1 {
+		t.Fatalf("expected 100.1 lb salt, got %+v", out.Doses)
+	}
+	if !strings.Contains(out.Doses[0].Notes, "About 2 x 40 lb bags") {
+		t.Fatalf("expected bags rounded down, got %q", out.Doses[0].Notes)
+	}
+	if out.SaltGenerator == nil || len(out.SaltGenerator.Notes) != 1 {
+		t.Fatalf("expected low-salt guidance, got %+v", out.SaltGenerator)
+	}
+}
+
+func TestCalculateDosingSaltIgnoredForChlorinePools(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"salt": 2400, "cya": 30},
+		Targets:           map[string]float64{"salt": 3200},
+	})
+	if len(out.Doses) != 0 || out.SaltGenerator != nil {
+		t.Fatalf("expected no salt guidance for chlorine pool, got %+v", out)
+	}
+}
+
+func TestCalculateDosingGeneratorOutput(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		SanitizerType:     "salt",
+		Readings:          map[string]float64{"salt": 3200, "cya": 70},
+		DailyFCDemand:     3,
+		SaltGenerator:     &SaltGenerator{RatedLbPerDay: 2, PumpHours: 10},
+	})
+	g := out.SaltGenerator
+	if g == nil || g.OutputPercent == nil || *g.OutputPercent != 65 {
+		t.Fatalf("expected 65%% output, got %+v", g)
+	}
+}
+
+func TestCalculateDosingGeneratorUndersized(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 40000,
+		IsSalt:            true,
+		Readings:          map[string]float64{"salt": 3200, "cya": 70},
+		DailyFCDemand:     6,
+		SaltGenerator:     &SaltGenerator{RatedLbPerDay: 1.5},
+	})
+	g := out.SaltGenerator
+	if *g.OutputPercent != 100 || !strings.Contains(g.Notes[0], "undersized") {
+		t.Fatalf("expected capped output with undersized note, got %+v", g)
+	}
+}
+
+func TestCalculateDosingGeneratorRatingMissing(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		SanitizerType:     "salt",
+		Readings:          map[string]float64{"salt": 3200, "cya": 70, "fc": 5, "ph": 7.5},
+		DailyFCDemand:     3,
+		SaltGenerator:     &SaltGenerator{PumpHours: 10},
+	})
+	g := out.SaltGenerator
+	if out.Confidence == "Low" || len(out.Missing) != 0 {
+		t.Fatalf("expected a missing rating not to lower dosing confidence, got %s %v", out.Confidence, out.Missing)
+	}
+	if g == nil || g.OutputPercent != nil || !strings.Contains(strings.Join(g.Notes, " "), "ratedLbPerDay") {
+		t.Fatalf("expected a generator note for the missing rating, got %+v", g)
+	}
+}
+
+func TestCalculateDosingAutoSaltTarget(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		IsSalt:            true,
+		AutoTargets:       true,
+		Readings:          map[string]float64{"salt": 2500, "cya": 70, "fc": 5},
+	})
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != "pool_salt" {
+		t.Fatalf("expected salt dose toward the generator midpoint, got %+v", out.Doses)
+	}
+}
+
+func TestBuildFallbackPlanSaltCell(t *testing.T) {
+	isSalt := true
+	fc, salt := 0.5, 2300.0
+	plan := BuildFallbackPlanWithContext("Cell shows low output and white flakes", &DiagnoseContext{
+		IsSalt:     &isSalt,
+		LatestTest: &DiagnoseWaterTest{FC: &fc, Salt: &salt},
+	})
+	joined := strings.Join(plan.Steps, " | ")
+	for _, want := range []string{"below the generator range", "flow switch", "white scale"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected %q in steps: %s", want, joined)
+		}
+	}
+	if err := ValidateDiagnosePlan(plan); err != nil {
+		t.Fatalf("fallback plan should validate: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type SaturationInput struct {
+	Test        DiagnoseWaterTest `json:"test"`
+	SurfaceType string            `json:"surfaceType,omitempty"`
+}
+
+type SaturationOutput struct {
+	Confidence          string   `json:"confidence"`
+	CSI                 float64  `json:"csi"`
+	LSI                 float64  `json:"lsi"`
+	CarbonateAlkalinity float64  `json:"carbonateAlkalinity"`
+	Status              string   `json:"status"`
+	Suggestions         []string `json:"suggestions"`
+	Assumptions         []string `json:"assumptions"`
+	Missing             []string `json:"missingFields"`
+}
+
+// Saturation thresholds shared by the endpoint and the fallback diagnosis.
+const (
+	saturationCorrosiveBelow = -0.3
+	saturationScalingAbove   = 0.3
+)
+
+// CalculateSaturation computes the Calcite Saturation Index (ionic-strength
+// corrected) and the classic Langelier index. Both use carbonate alkalinity,
+// i.e. TA with the cyanurate and borate contributions removed.
+func CalculateSaturation(in SaturationInput) SaturationOutput {
+	out := SaturationOutput{Confidence: "Medium", Suggestions: []string{}, Assumptions: []string{}, Missing: []string{}}
+	test := in.Test
+	if test.PH == nil {
+		out.Missing = append(out.Missing, "ph")
+	}
+	if test.TA == nil || *test.TA <= 0 {
+		out.Missing = append(out.Missing, "ta")
+	}
+	if test.CH == nil || *test.CH <= 0 {
+		out.Missing = append(out.Missing, "ch")
+	}
+	if len(out.Missing) > 0 {
+		out.Confidence = "Low"
+		return out
+	}
+	ph, ta, ch := *test.PH, *test.TA, *test.CH
+
+	tempF, tempKey := 80.0, "tempF"
+	if test.TempF != nil {
+		tempF = *test.TempF
+	} else if test.TempC != nil {
+		tempF, tempKey = celsiusToFahrenheit(*test.TempC), "tempC"
+	} else {
+		out.Assumptions = append(out.Assumptions, "Water temperature not provided; assumed 80F.")
+	}
+	if limits := plausibleRanges["tempF"]; !(tempF >= limits[0] && tempF <= limits[1]) {
+		out.Missing = append(out.Missing, tempKey)
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Water temperature %gF is outside the plausible %g-%gF range; retest.", round(tempF), limits[0], limits[1]))
+		out.Confidence = "Low"
+		return out
+	}
+	cya := 0.0
+	if test.CYA != nil {
+		cya = *test.CYA
+	} else {
+		out.Assumptions = append(out.Assumptions, "CYA not provided; no cyanurate alkalinity correction applied.")
+		out.Confidence = "Low"
+	}
+	borates := 0.0
+	if test.Borates != nil {
+		borates = *test.Borates
+	}
+	salt := 0.0
+	if test.Salt != nil {
+		salt = *test.Salt
+	}
+
+	carbAlk := carbonateAlkalinity(ph, ta, cya, borates)
+	if carbAlk <= 0 {
+		out.Missing = append(out.Missing, "ta")
+		out.Assumptions = append(out.Assumptions, "TA is fully accounted for by CYA/borates; saturation cannot be computed.")
+		out.Confidence = "Low"
+		return out
+	}
+	out.CarbonateAlkalinity = round(carbAlk)
+
+	extraNaCl := salt
+	if salt == 0 && test.TDS != nil {
+		extraNaCl = math.Max(0, *test.TDS-1.5*ch-ta)
+	}
+	tempC := (tempF - 32) * 5 / 9
+	ionic := (1.5*ch+ta)/50045 + extraNaCl/58440
+	csi := ph - 6.9395 + math.Log10(ch) + math.Log10(carbAlk) -
+		2.56*math.Sqrt(ionic)/(1+1.65*math.Sqrt(ionic)) - 1412.5/(tempC+273.15)
+
+	tds := 1000.0
+	if test.TDS != nil && *test.TDS > 0 {
+		tds = *test.TDS
+	} else if salt > 0 {
+		tds = salt + 1.5*ch + ta
+	} else {
+		out.Assumptions = append(out.Assumptions, "TDS not provided; LSI assumes 1000 ppm.")
+	}
+	a := (math.Log10(tds) - 1) / 10
+	b := -13.12*math.Log10(tempC+273.15) + 34.55
+	c := math.Log10(ch) - 0.4
+	d := math.Log10(carbAlk)
+	lsi := ph - ((9.3 + a + b) - (c + d))
+	// Out-of-range inputs (negative salt or TDS) can still push the logs and
+	// square roots off the real line; NaN and Inf do not encode as JSON.
+	if !isFinite(csi) || !isFinite(lsi) {
+		out.Assumptions = append(out.Assumptions, "Saturation is undefined for these readings; check salt, TDS and temperature.")
+		out.Confidence = "Low"
+		out.CarbonateAlkalinity = 0
+		return out
+	}
+	out.CSI, out.LSI = round2(csi), round2(lsi)
+
+	out.Status = saturationStatus(csi)
+	out.Suggestions = saturationSuggestions(out.Status, ph, ta, ch, in.SurfaceType)
+	return out
+}
+
+// carbonateAlkalinity strips the cyanurate and borate buffers out of TA.
+func carbonateAlkalinity(ph, ta, cya, borates float64) float64 {
+	return ta - 0.38772*cya/(1+math.Pow(10, 6.83-ph)) - 4.63*borates/(1+math.Pow(10, 9.11-ph))
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func saturationStatus(csi float64) string {
+	switch {
+	case csi < saturationCorrosiveBelow:
+		return "corrosive"
+	case csi > saturationScalingAbove:
+		return "scaling"
+	default:
+		return "balanced"
+	}
+}
+
+// saturationSuggestions names the parameter to move first. pH is the cheapest
+// lever, CH is only raised on plaster-type surfaces and only lowered by dilution.
+func saturationSuggestions(status string, ph, ta, ch float64, surface string) []string {
+	plaster := strings.EqualFold(strings.TrimSpace(surface), "plaster")
+	var out []string
+	switch status {
+	case "corrosive":
+		if ph < 7.4 {
+			out = append(out, fmt.Sprintf("Raise pH from %.1f toward 7.6.", ph))
+		}
+		if ch < 250 && plaster {
+			out = append(out, fmt.Sprintf("Raise calcium hardness from %.0f toward 300-350 ppm to protect plaster.", ch))
+		}
+		if ta < 70 {
+			out = append(out, fmt.Sprintf("Raise TA from %.0f toward 80 ppm.", ta))
+		}
+		if len(out) == 0 {
+			out = append(out, "Raise pH toward 7.8 or calcium hardness to bring the index up.")
+		}
+		if plaster {
+			out = append(out, "Corrosive water etches plaster; correct before the next visit.")
+		}
+	case "scaling":
+		if ph > 7.8 {
+			out = append(out, fmt.Sprintf("Lower pH from %.1f toward 7.5.", ph))
+		}
+		if ta > 100 {
+			out = append(out, fmt.Sprintf("Lower TA from %.0f toward 80 ppm with acid and aeration.", ta))
+		}
+		if ch > 500 {
+			out = append(out, fmt.Sprintf("Calcium hardness %.0f ppm is high; partial drain and refill to dilute.", ch))
+		}
+		if len(out) == 0 {
+			out = append(out, "Lower pH toward 7.4 to bring the index down.")
+		}
+	default:
+		out = append(out, "Water is balanced; no saturation correction needed.")
+	}
+	return out
+}
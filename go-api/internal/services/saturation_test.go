@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestCalculateSaturationBalanced(t *testing.T) {
+	out := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(7.5), TA: floatPtr(80), CH: floatPtr(300), CYA: floatPtr(30), TempF: floatPtr(80),
+	}})
+	if math.Abs(out.CSI-(-0.05)) > 0.02 {
+		t.Fatalf("expected CSI near -0.05, got %v", out.CSI)
+	}
+	if out.Status != "balanced" {
+		t.Fatalf("expected balanced, got %s", out.Status)
+	}
+	if out.CarbonateAlkalinity >= 80 {
+		t.Fatalf("expected CYA correction to reduce carbonate alkalinity, got %v", out.CarbonateAlkalinity)
+	}
+}
+
+func TestCalculateSaturationUsesCelsius(t *testing.T) {
+	metric := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(7.5), TA: floatPtr(80), CH: floatPtr(300), CYA: floatPtr(30), TempC: floatPtr(15),
+	}})
+	imperial := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(7.5), TA: floatPtr(80), CH: floatPtr(300), CYA: floatPtr(30), TempF: floatPtr(59),
+	}})
+	if metric.CSI != imperial.CSI || len(metric.Assumptions) != len(imperial.Assumptions) {
+		t.Fatalf("expected 15C to match 59F, got %+v vs %+v", metric, imperial)
+	}
+}
+
+func TestCalculateSaturationCorrosivePlaster(t *testing.T) {
+	out := CalculateSaturation(SaturationInput{
+		Test:        DiagnoseWaterTest{PH: floatPtr(7.2), TA: floatPtr(60), CH: floatPtr(150), CYA: floatPtr(50), TempF: floatPtr(65)},
+		SurfaceType: "plaster",
+	})
+	if out.Status != "corrosive" {
+		t.Fatalf("expected corrosive, got %s (CSI %v)", out.Status, out.CSI)
+	}
+	if !strings.Contains(strings.Join(out.Suggestions, " "), "calcium hardness") {
+		t.Fatalf("expected calcium suggestion for plaster, got %v", out.Suggestions)
+	}
+}
+
+func TestCalculateSaturationScalingWithSalt(t *testing.T) {
+	out := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(8.2), TA: floatPtr(120), CH: floatPtr(450), CYA: floatPtr(70), TempF: floatPtr(90), Salt: floatPtr(3200), Borates: floatPtr(50),
+	}})
+	if out.Status != "scaling" {
+		t.Fatalf("expected scaling, got %s (CSI %v)", out.Status, out.CSI)
+	}
+	if !strings.Contains(out.Suggestions[0], "Lower pH") {
+		t.Fatalf("expected pH to be the first lever, got %v", out.Suggestions)
+	}
+}
+
+func TestCalculateSaturationMissingInputs(t *testing.T) {
+	out := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{PH: floatPtr(7.5)}})
+	if out.Confidence != "Low" || len(out.Missing) != 2 {
+		t.Fatalf("expected Low confidence with ta and ch missing, got %s %v", out.Confidence, out.Missing)
+	}
+}
+
+func TestCalculateSaturationRejectsAbsurdInputs(t *testing.T) {
+	out := CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(7.5), TA: floatPtr(80), CH: floatPtr(300), CYA: floatPtr(30), TempF: floatPtr(-459.67),
+	}})
+	if out.Confidence != "Low" || len(out.Missing) != 1 || out.Missing[0] != "tempF" {
+		t.Fatalf("expected absurd temperature to be rejected, got %+v", out)
+	}
+	out = CalculateSaturation(SaturationInput{Test: DiagnoseWaterTest{
+		PH: floatPtr(7.5), TA: floatPtr(80), CH: floatPtr(300), CYA: floatPtr(30), TempF: floatPtr(80), Salt: floatPtr(-100000),
+	}})
+	if out.Confidence != "Low" || out.Status != "" {
+		t.Fatalf("expected non-finite saturation to be rejected, got %+v", out)
+	}
+	if _, err := json.Marshal(out); err != nil {
+		t.Fatalf("expected JSON-safe output, got %v", err)
+	}
+}
+
+func TestBuildFallbackPlanFlagsCorrosiveWater(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("Rough plaster", &DiagnoseContext{
+		SurfaceType: "plaster",
+		LatestTest:  &DiagnoseWaterTest{PH: floatPtr(7.0), TA: floatPtr(50), CH: floatPtr(120), CYA: floatPtr(40), TempF: floatPtr(60)},
+	})
+	if !strings.Contains(strings.Join(plan.Steps, " "), "corrosive") {
+		t.Fatalf("expected corrosive saturation step, got %v", plan.Steps)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SequenceStep is one addition in the order a tech should pour it.
+type SequenceStep struct {
+	Step int `json:"step"`
+	Dose
+	Part        string `json:"part,omitempty"`
+	WaitMinutes int    `json:"waitMinutes"`
+	Reason      string `json:"reason"`
+}
+
+// sequenceRule places a chemical in the visit. Lower ranks go first;
+// SplitAbove (in the dose's imperial unit) breaks large amounts into parts.
+type sequenceRule struct {
+	Prefix      string
+	Rank        int
+	WaitMinutes int
+	SplitAbove  float64
+	Reason      string
+}
+
+var sequenceRules = []sequenceRule{
+	{"metal_sequestrant", 5, 30, 0, "Sequester metals first so later oxidizers do not drop them out as stains."},
+	{"sodium_bicarbonate", 10, 60, 5, "Adjust TA first; it sets the buffer the pH change works against."},
+	{"boric_acid", 15, 60, 10, "Raise borates before fine-tuning pH; boric acid nudges pH down as it dissolves."},
+	{"muriatic_acid", 20, 30, 32, "Adjust pH once TA is set."},
+	{"sodium_carbonate", 20, 30, 16, "Adjust pH once TA is set."},
+	{"sodium_tetraborate", 20, 30, 32, "Adjust pH once TA is set."},
+	{"liquid_chlorine", 30, 30, 128, "Sanitize after pH is in range so chlorine is effective."},
+	{"cal_hypo", 30, 30, 32, "Sanitize after pH is in range so chlorine is effective."},
+	{"dichlor", 30, 30, 32, "Sanitize after pH is in range so chlorine is effective."},
+	{"lithium_hypo", 30, 30, 32, "Sanitize after pH is in range so chlorine is effective."},
+	{"trichlor", 30, 0, 0, "Load the feeder after pH is in range."},
+	{"potassium_monopersulfate", 30, 30, 32, "Oxidize after pH is in range; it lowers pH slightly."},
+	{"sodium_bromide", 25, 30, 48, "Build the bromide bank before the oxidizer that converts it to bromine."},
+	{"cyanuric_acid", 40, 15, 0, "Stabilizer dissolves slowly in a skimmer sock; start it once pH is set."},
+	{"phosphate_remover", 45, 60, 0, "Remove phosphates once the water is sanitized; the floc it forms needs an hour of filtration."},
+	{"enzyme_clarifier", 45, 15, 0, "Add enzymes to balanced, sanitized water."},
+	{"pool_salt", 50, 15, 80, "Broadcast salt with the generator off; it dissolves over 24h."},
+	{"calcium_chloride", 60, 30, 10, "Calcium last, into balanced water, so it does not cloud or scale."},
+}
+
+var defaultSequenceRule = sequenceRule{Rank: 55, WaitMinutes: 30, Reason: "Add separately with the pump running."}
+
+// Visit timing: a test at arrival plus a few minutes per addition.
+const (
+	visitTestMinutes    = 10
+	visitPerStepMinutes = 5
+	acidChlorineMinWait = 30
+)
+
+func sequenceRuleFor(chemical string) sequenceRule {
+	for _, rule := range sequenceRules {
+		if strings.HasPrefix(chemical, rule.Prefix) {
+			return rule
+		}
+	}
+	return defaultSequenceRule
+}
+
+func isChlorineChemical(chemical string) bool {
+	for _, product := range chlorineProducts {
+		if strings.HasPrefix(chemical, product.chemicalPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceDoses orders doses by dependency, splits large amounts and puts a
+// circulation wait after each addition. The wait after the last step is the
+// circulation before retesting and is not counted in the visit time.
+func sequenceDoses(doses []Dose) ([]SequenceStep, int) {
+	ordered := make([]Dose, len(doses))
+	copy(ordered, doses)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return sequenceRuleFor(ordered[i].Chemical).Rank < sequenceRuleFor(ordered[j].Chemical).Rank
+	})
+
+	steps := []SequenceStep{}
+	for _, d := range ordered {
+		rule := sequenceRuleFor(d.Chemical)
+		parts := 1
+		if rule.SplitAbove > 0 && d.Amount > rule.SplitAbove {
+			parts = int(math.Ceil(d.Amount / rule.SplitAbove))
+		}
+		for p := 1; p <= parts; p++ {
+			step := SequenceStep{Dose: d, WaitMinutes: rule.WaitMinutes, Reason: rule.Reason}
+			if parts > 1 {
+				step.Amount = d.Amount / float64(parts)
+				step.Part = fmt.Sprintf("%d/%d", p, parts)
+				if p > 1 {
+					step.Reason = "Remaining part; retest before adding if readings are already on target."
+				}
+			}
+			steps = append(steps, step)
+		}
+	}
+
+	minutes := visitTestMinutes
+	for i := range steps {
+		steps[i].Step = i + 1
+		if i+1 < len(steps) {
+			a, b := steps[i].Chemical, steps[i+1].Chemical
+			acidThenChlorine := strings.HasPrefix(a, "muriatic_acid") && isChlorineChemical(b)
+			chlorineThenAcid := isChlorineChemical(a) && strings.HasPrefix(b, "muriatic_acid")
+			if (acidThenChlorine || chlorineThenAcid) && steps[i].WaitMinutes < acidChlorineMinWait {
+				steps[i].WaitMinutes = acidChlorineMinWait
+			}
+			minutes += steps[i].WaitMinutes
+		}
+		minutes += visitPerStepMinutes
+	}
+	if len(steps) == 0 {
+		minutes = 0
+	}
+	return steps, minutes
+}
@@ -0,0 +1,67 @@
+package services
+
+import "testing"
+
+func TestCalculateDosingSequencesDependencies(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 18000,
+		Readings:          map[string]float64{"fc": 2, "ph": 7.8, "ta": 70, "ch": 200, "cya": 20},
+		Targets:           map[string]float64{"fc": 5, "ph": 7.5, "ta": 90, "ch": 300, "cya": 40},
+	})
+	var order []string
+	for _, step := range out.Sequence {
+		if step.Part == "" || step.Part == "1/2" || step.Part == "1/3" {
+			order = append(order, step.Chemical)
+		}
+	}
+	want := []string{"sodium_bicarbonate", "muriatic_acid_31_45pct", "liquid_chlorine_10pct", "cyanuric_acid", "calcium_chloride"}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+	last := out.Sequence[len(out.Sequence)-1]
+	if last.Chemical != "calcium_chloride" || last.Part != "3/3" {
+		t.Fatalf("expected 22.5 lb calcium split into thirds last, got %+v", last)
+	}
+	if out.VisitMinutes <= 0 {
+		t.Fatalf("expected visit duration, got %d", out.VisitMinutes)
+	}
+}
+
+func TestSequenceDosesSplitsAndTimesVisit(t *testing.T) {
+	steps, minutes := sequenceDoses([]Dose{
+		{Chemical: "liquid_chlorine_10pct", Amount: 200, Unit: "oz"},
+		{Chemical: "sodium_bicarbonate", Amount: 8, Unit: "lb"},
+	})
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 steps, got %+v", steps)
+	}
+	if steps[0].Chemical != "sodium_bicarbonate" || steps[0].Amount != 4 || steps[0].Part != "1/2" {
+		t.Fatalf("expected bicarbonate split first, got %+v", steps[0])
+	}
+	// test + 4 additions + waits after steps 1-3 (60 + 60 + 30).
+	if minutes != 10+4*5+150 {
+		t.Fatalf("expected 180 minutes, got %d", minutes)
+	}
+}
+
+func TestSequenceDosesSeparatesAcidAndChlorine(t *testing.T) {
+	steps, _ := sequenceDoses([]Dose{
+		{Chemical: "trichlor_90pct", Amount: 1, Unit: "tablets"},
+		{Chemical: "muriatic_acid_31_45pct", Amount: 10, Unit: "oz"},
+	})
+	if steps[0].Chemical != "muriatic_acid_31_45pct" || steps[0].WaitMinutes < acidChlorineMinWait {
+		t.Fatalf("expected acid first with a circulation wait, got %+v", steps)
+	}
+}
+
+func TestSequenceDosesEmpty(t *testing.T) {
+	steps, minutes := sequenceDoses(nil)
+	if len(steps) != 0 || minutes != 0 {
+		t.Fatalf("expected empty sequence, got %v %d", steps, minutes)
+	}
+}
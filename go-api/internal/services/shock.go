@@ -0,0 +1,177 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type ShockPlanInput struct {
+	PoolVolumeGallons float64            `json:"poolVolumeGallons"`
+	Readings          map[string]float64 `json:"readings"`
+	ProductStrengths  map[string]float64 `json:"productStrengths"`
+	SanitizerType     string             `json:"sanitizerType,omitempty"`
+	IsSalt            bool               `json:"isSalt,omitempty"`
+	Day               int                `json:"day"`
+	Days              int                `json:"days,omitempty"`
+	WaterClear        bool               `json:"waterClear"`
+	OvernightFCLoss   *float64           `json:"overnightFcLoss,omitempty"`
+	RuleSet           string             `json:"ruleSet,omitempty"`
+	Tenant            string             `json:"tenant,omitempty"`
+}
+
+type ShockDay struct {
+	Day       int      `json:"day"`
+	HoldAbove float64  `json:"holdAbove"`
+	Projected bool     `json:"projected"`
+	Actions   []string `json:"actions"`
+	Doses     []Dose   `json:"doses"`
+}
+
+type ShockPlanOutput struct {
+	Confidence   string     `json:"confidence"`
+	ShockLevel   float64    `json:"shockLevel"`
+	Complete     bool       `json:"complete"`
+	Schedule     []ShockDay `json:"schedule"`
+	ExitCriteria []string   `json:"exitCriteria"`
+	Assumptions  []string   `json:"assumptions"`
+	SafetyNotes  []string   `json:"safetyNotes"`
+	Missing      []string   `json:"missingFields"`
+}
+
+// Exit thresholds for a shock run: combined chlorine gone, water clear and
+// an overnight chlorine loss test (OCLT) showing no remaining demand.
+const (
+	shockExitMaxCC   = 0.5
+	shockExitMaxOCLT = 1.0
+	shockHoldRatio   = 0.8
+	defaultShockDays = 4
+	maxShockDays     = 14
+)
+
+// PlanShock builds a day-by-day algae clearing schedule starting from the
+// latest readings. Callers re-submit with fresh readings and the next day
+// number to recompute; only the first day is dosed from measured FC. Day
+// defaults to 1.
+func PlanShock(in ShockPlanInput) ShockPlanOutput {
+	out := ShockPlanOutput{
+		Confidence: "Medium",
+		Schedule:   []ShockDay{},
+		ExitCriteria: []string{
+			fmt.Sprintf("Combined chlorine at or below %.1f ppm.", shockExitMaxCC),
+			"Water is clear enough to see the main drain.",
+			fmt.Sprintf("Overnight chlorine loss test drops %.0f ppm or less.", shockExitMaxOCLT),
+		},
+		Assumptions: []string{},
+		SafetyNotes: []string{
+			"Keep swimmers out until FC falls back below the shock level.",
+			"Never mix chemicals directly. Add chlorine with the pump running.",
+			"Always retest before additional dosing.",
+		},
+		Missing: []string{},
+	}
+	if in.Day <= 0 {
+		in.Day = 1
+	}
+	if in.PoolVolumeGallons <= 0 {
+		out.Missing = append(out.Missing, "poolVolumeGallons")
+	}
+	if isBromine(in.SanitizerType) {
+		// SLAM levels come from CYA, which bromine pools do not use.
+		out.Assumptions = append(out.Assumptions, "SLAM shock levels are set from CYA and do not apply to bromine; shock with a non-chlorine oxidizer using the dosing calculator.")
+		if len(out.Missing) > 0 {
+			out.Confidence = "Low"
+		}
+		return out
+	}
+	fc, hasFC := in.Readings["fc"]
+	if !hasFC {
+		out.Missing = append(out.Missing, "fc")
+	}
+	rec, err := RecommendFCTargets(in.Readings, in.SanitizerType, in.IsSalt)
+	if err != nil {
+		out.Missing = append(out.Missing, "cya")
+		out.Assumptions = append(out.Assumptions, "Shock level unknown: "+err.Error()+".")
+	}
+	if len(out.Missing) > 0 {
+		out.Confidence = "Low"
+		return out
+	}
+	out.ShockLevel = rec.Shock
+	out.Assumptions = append(out.Assumptions, rec.Rationale)
+	hold := round(rec.Shock * shockHoldRatio)
+
+	cc, hasCC := in.Readings["cc"]
+	if in.OvernightFCLoss != nil && hasCC && cc <= shockExitMaxCC && in.WaterClear && *in.OvernightFCLoss <= shockExitMaxOCLT {
+		out.Complete = true
+		out.Schedule = append(out.Schedule, ShockDay{
+			Day:       in.Day,
+			HoldAbove: rec.Minimum,
+			Actions: []string{
+				"All exit criteria met; stop shocking.",
+				fmt.Sprintf("Let FC drift down and maintain %.1f-%.1f ppm.", rec.Minimum, rec.Target),
+			},
+			Doses: []Dose{},
+		})
+		return out
+	}
+	if !hasCC {
+		out.Assumptions = append(out.Assumptions, "CC not provided; exit cannot be confirmed until it is tested.")
+	}
+
+	dailyLoss := rec.Shock * 0.5
+	if in.OvernightFCLoss != nil {
+		dailyLoss = math.Max(*in.OvernightFCLoss*2, 1)
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Daytime loss projected at twice the %.1f ppm overnight loss.", *in.OvernightFCLoss))
+	} else {
+		out.Assumptions = append(out.Assumptions, "Projected days assume half the shock level is lost per day; recompute with real readings.")
+	}
+
+	days := in.Days
+	if days <= 0 {
+		days = defaultShockDays
+	}
+	days = min(days, maxShockDays)
+	for i := 0; i < days; i++ {
+		from := rec.Shock - dailyLoss
+		if i == 0 {
+			from = fc
+		}
+		day := ShockDay{Day: in.Day + i, HoldAbove: hold, Projected: i > 0, Doses: []Dose{}}
+		if dose, capped, ok := shockChlorineDose(in, from, rec.Shock); ok {
+			day.Doses = append(day.Doses, dose)
+			if capped {
+				day.Actions = append(day.Actions, "Dose is capped; circulate 1 hour, retest and repeat to reach the shock level.")
+			}
+			day.Actions = append(day.Actions, fmt.Sprintf("Raise FC to %.1f ppm.", rec.Shock))
+		}
+		day.Actions = append(day.Actions,
+			"Brush walls and floor; run the pump 24 hours.",
+			fmt.Sprintf("Test FC at least twice; top up to %.1f ppm whenever it falls below %.1f ppm.", rec.Shock, hold),
+			"Test FC at dusk and again at dawn for the overnight chlorine loss test.",
+		)
+		out.Schedule = append(out.Schedule, day)
+	}
+	return out
+}
+
+// shockChlorineDose reuses CalculateDosing for the chlorine leg so the shock
+// planner and the calculator never disagree on strength or caps. The cap is
+// checked against the same tenant rule set the calculator resolves.
+func shockChlorineDose(in ShockPlanInput, from, to float64) (Dose, bool, bool) {
+	calc := CalculateDosing(CalcInput{
+		PoolVolumeGallons: in.PoolVolumeGallons,
+		Readings:          map[string]float64{"fc": from, "cya": in.Readings["cya"]},
+		Targets:           map[string]float64{"fc": to},
+		ProductStrengths:  in.ProductStrengths,
+		RuleSet:           in.RuleSet,
+		Tenant:            in.Tenant,
+	})
+	rules, _ := resolveRuleSet(in.RuleSet, in.Tenant)
+	for _, d := range calc.Doses {
+		if strings.HasPrefix(d.Chemical, "liquid_chlorine") {
+			return d, d.Amount >= rules.LiquidChlorineCapOz, true
+		}
+	}
+	return Dose{}, false, false
+}
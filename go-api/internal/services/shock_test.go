@@ -0,0 +1,114 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPlanShockBuildsSchedule(t *testing.T) {
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"fc": 2, "cc": 1.5, "cya": 40},
+		Day:               1,
+	})
+	if out.Confidence != "Medium" || out.ShockLevel != 16 {
+		t.Fatalf("expected shock level 16 at Medium confidence, got %+v", out)
+	}
+	if len(out.Schedule) != defaultShockDays {
+		t.Fatalf("expected %d days, got %d", defaultShockDays, len(out.Schedule))
+	}
+	first := out.Schedule[0]
+	if first.Day != 1 || first.Projected || len(first.Doses) != 1 {
+		t.Fatalf("unexpected first day: %+v", first)
+	}
+	want := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 15000,
+		Readings:          map[string]float64{"fc": 2, "cya": 40},
+		Targets:           map[string]float64{"fc": 16},
+	}).Doses[0]
+	if first.Doses[0] != want {
+		t.Fatalf("expected dose to match calculator %+v, got %+v", want, first.Doses[0])
+	}
+	if !out.Schedule[1].Projected || out.Schedule[1].HoldAbove != 12.8 {
+		t.Fatalf("unexpected projected day: %+v", out.Schedule[1])
+	}
+}
+
+func TestPlanShockUsesOvernightLoss(t *testing.T) {
+	loss := 2.0
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 14, "cc": 0.8, "cya": 30},
+		Day:               3,
+		OvernightFCLoss:   &loss,
+	})
+	projected := out.Schedule[1].Doses[0]
+	if projected.Amount != 51.2 {
+		t.Fatalf("expected 4 ppm top-up (51.2 oz), got %+v", projected)
+	}
+}
+
+func TestPlanShockComplete(t *testing.T) {
+	loss := 0.5
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 10, "cc": 0.2, "cya": 30},
+		Day:               5,
+		WaterClear:        true,
+		OvernightFCLoss:   &loss,
+	})
+	if !out.Complete || len(out.Schedule) != 1 || len(out.Schedule[0].Doses) != 0 {
+		t.Fatalf("expected completed run, got %+v", out)
+	}
+}
+
+func TestPlanShockNeedsCYA(t *testing.T) {
+	out := PlanShock(ShockPlanInput{PoolVolumeGallons: 10000, Readings: map[string]float64{"fc": 1}})
+	if out.Confidence != "Low" || len(out.Schedule) != 0 {
+		t.Fatalf("expected Low confidence without schedule, got %+v", out)
+	}
+}
+
+func TestPlanShockDefaultsToDayOne(t *testing.T) {
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 2, "cya": 30},
+	})
+	if out.Schedule[0].Day != 1 || out.Schedule[1].Day != 2 {
+		t.Fatalf("expected schedule to start on day 1, got %+v", out.Schedule)
+	}
+}
+
+func TestPlanShockBromineSkipsCYA(t *testing.T) {
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 400,
+		Readings:          map[string]float64{"br": 1},
+		SanitizerType:     "bromine",
+	})
+	if out.Confidence != "Medium" || len(out.Missing) != 0 || len(out.Schedule) != 0 {
+		t.Fatalf("expected bromine plan without CYA at Medium confidence, got %+v", out)
+	}
+}
+
+func TestPlanShockUsesTenantRuleSet(t *testing.T) {
+	data, err := os.ReadFile("../../rules/dosing-rules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestRuleSets(t, string(data)); err != nil {
+		t.Fatal(err)
+	}
+	out := PlanShock(ShockPlanInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 0, "cc": 1, "cya": 40},
+		Tenant:            "acme-pools",
+	})
+	first := out.Schedule[0]
+	if first.Doses[0].Chemical != "liquid_chlorine_8pct" || first.Doses[0].Amount != 384 {
+		t.Fatalf("expected tenant strength and cap, got %+v", first.Doses)
+	}
+	if !strings.Contains(first.Actions[0], "capped") {
+		t.Fatalf("expected capped action at the tenant cap, got %v", first.Actions)
+	}
+}
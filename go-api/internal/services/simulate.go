@@ -0,0 +1,246 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type SimulateInput struct {
+	PoolVolumeGallons float64            `json:"poolVolumeGallons"`
+	PoolVolumeLiters  float64            `json:"poolVolumeLiters,omitempty"`
+	UnitSystem        string             `json:"unitSystem,omitempty"`
+	SurfaceType       string             `json:"surfaceType,omitempty"`
+	SanitizerType     string             `json:"sanitizerType,omitempty"`
+	Readings          map[string]float64 `json:"readings"`
+	Doses             []Dose             `json:"doses"`
+	RuleSet           string             `json:"ruleSet,omitempty"`
+	Tenant            string             `json:"tenant,omitempty"`
+
+	rules *RuleSet
+}
+
+type SimulateOutput struct {
+	Confidence     string             `json:"confidence"`
+	Before         map[string]float64 `json:"before"`
+	After          map[string]float64 `json:"after"`
+	Saturation     *SaturationOutput  `json:"saturation,omitempty"`
+	Effects        []string           `json:"effects"`
+	Assumptions    []string           `json:"assumptions"`
+	Missing        []string           `json:"missingFields"`
+	RuleSetVersion string             `json:"ruleSetVersion"`
+}
+
+// Per-unit effects in 10k gallons, derived from the stoichiometry of each
+// product. Side effects (pH drift from hypochlorite, TA consumed by acid,
+// salt left behind by chlorine) are what techs most often forget.
+const (
+	taDropPerAcidOz      = 0.39
+	taRisePerSodaAshOz   = 0.706
+	taRisePerBoraxOz     = 0.197
+	boratesPerBoraxOz    = 0.085
+	saltPerPPMChlorine   = 1.65
+	phRisePerPPMHypo     = 0.02
+	phDropPerPPMTrichlor = 0.02
+)
+
+var strengthSuffix = regexp.MustCompile(`_(\d+(?:\.\d+)?)pct$`)
+
+// Simulate predicts the water after the given doses are fully added, in
+// order. It is the inverse of the calculator's dose formulas plus the side
+// effects each product has on the other readings.
+func Simulate(in SimulateInput) SimulateOutput {
+	out := SimulateOutput{Confidence: "Medium", Effects: []string{}, Assumptions: []string{"Assumes each dose is added in full and fully circulated."}, Missing: []string{}}
+	system, err := resolveUnitSystem(in.UnitSystem)
+	if err != nil {
+		out.Assumptions = append(out.Assumptions, err.Error()+"; using imperial.")
+	}
+	if in.rules == nil {
+		rules, err := resolveRuleSet(in.RuleSet, in.Tenant)
+		if err != nil {
+			out.Assumptions = append(out.Assumptions, err.Error()+"; using "+rules.Version+".")
+		}
+		in.rules = &rules
+	}
+	out.RuleSetVersion = in.rules.Version
+	pool := in.PoolVolumeGallons
+	if system == UnitsMetric && in.PoolVolumeLiters > 0 {
+		pool = litersToGallons(in.PoolVolumeLiters)
+	}
+	out.Before = roundedReadings(in.Readings)
+	if pool <= 0 {
+		if system == UnitsMetric {
+			out.Missing = append(out.Missing, "poolVolumeLiters")
+		} else {
+			out.Missing = append(out.Missing, "poolVolumeGallons")
+		}
+		out.Confidence = "Low"
+		out.After = out.Before
+		return out
+	}
+
+	water := make(map[string]float64, len(in.Readings))
+	for k, v := range in.Readings {
+		water[k] = v
+	}
+	// Chlorine added to bromine water oxidizes the bromide bank, so it shows up
+	// as bromine rather than FC.
+	sanitizer := sanitizerEffect{"fc", "FC", 1}
+	if _, hasBr := in.Readings["br"]; hasBr || isBromine(in.SanitizerType) {
+		sanitizer = sanitizerEffect{"br", "bromine", brPerPPMChlorine}
+	}
+	for _, d := range in.Doses {
+		amount, unit := measureAmount(d.Chemical, d.Amount, d.Unit)
+		amount, unit = imperialAmount(amount, unit)
+		if unit == "oz" && isPoundChemical(d.Chemical) {
+			amount, unit = amount/16, "lb"
+		}
+		effect, ok := applyDose(water, d.Chemical, amount, unit, pool/10000, *in.rules, sanitizer)
+		if !ok {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("No model for %s in %s; effect ignored.", d.Chemical, d.Unit))
+			out.Confidence = "Low"
+			continue
+		}
+		out.Effects = append(out.Effects, effect)
+	}
+	out.After = roundedReadings(water)
+
+	test := DiagnoseWaterTest{}
+	for key, field := range map[string]**float64{"ph": &test.PH, "ta": &test.TA, "ch": &test.CH, "cya": &test.CYA, "salt": &test.Salt, "borates": &test.Borates, "tds": &test.TDS, "tempF": &test.TempF, "tempC": &test.TempC} {
+		if v, ok := water[key]; ok {
+			*field = &v
+		}
+	}
+	if sat := CalculateSaturation(SaturationInput{Test: test, SurfaceType: in.SurfaceType}); len(sat.Missing) == 0 {
+		out.Saturation = &sat
+	}
+	return out
+}
+
+// sanitizerEffect is the reading a ppm of chlorine raises: FC, or bromine
+// at brPerPPMChlorine in bromine water.
+type sanitizerEffect struct {
+	key, label string
+	perFC      float64
+}
+
+// applyDose mutates water for one dose given in imperial units. units is
+// the pool volume in 10k-gallon units.
+func applyDose(water map[string]float64, chemical string, amount float64, unit string, units float64, rules RuleSet, sanitizer sanitizerEffect) (string, bool) {
+	strength := 0.0
+	if m := strengthSuffix.FindStringSubmatch(chemical); m != nil {
+		strength, _ = strconv.ParseFloat(m[1], 64)
+	}
+	prefix := strengthSuffix.ReplaceAllString(chemical, "")
+	switch {
+	case prefix == "liquid_chlorine" && unit == "oz" && strength > 0:
+		fc := (amount / 128) * strength / units
+		bump(water, sanitizer.key, fc*sanitizer.perFC)
+		bump(water, "ph", fc*phRisePerPPMHypo)
+		bump(water, "salt", fc*saltPerPPMChlorine)
+		return fmt.Sprintf("%s: %s +%.1f, pH +%.2f, salt +%.0f", chemical, sanitizer.label, fc*sanitizer.perFC, fc*phRisePerPPMHypo, fc*saltPerPPMChlorine), true
+	case strings.HasPrefix(chemical, "muriatic_acid") && unit == "oz":
+		ta, ok := water["ta"]
+		if !ok {
+			ta = rules.DefaultTA
+		}
+		dpH := amount / units / (rules.AcidOzPer10kPerPH * ta / 100 * borateFactor(water))
+		dTA := amount * taDropPerAcidOz / units
+		bump(water, "ph", -dpH)
+		bump(water, "ta", -dTA)
+		return fmt.Sprintf("%s: pH -%.2f, TA -%.0f", chemical, dpH, dTA), true
+	case (prefix == "cal_hypo" || prefix == "dichlor" || prefix == "trichlor" || prefix == "lithium_hypo") && strength > 0:
+		product := chlorineProducts[prefix]
+		oz := amount
+		if unit == product.Unit && product.OzPerUnit > 0 {
+			oz = amount * product.OzPerUnit
+		} else if unit != "oz" {
+			return "", false
+		}
+		fc := oz * strength / 100 / dryOzPerPPMPer10k / units
+		bump(water, sanitizer.key, fc*sanitizer.perFC)
+		bump(water, "cya", fc*product.CYAPerPPM)
+		bump(water, "ch", fc*product.CHPerPPM)
+		dpH := 0.0
+		switch prefix {
+		case "trichlor":
+			dpH = -fc * phDropPerPPMTrichlor
+		case "cal_hypo", "lithium_hypo":
+			dpH = fc * phRisePerPPMHypo
+		}
+		bump(water, "ph", dpH)
+		return fmt.Sprintf("%s: %s +%.1f, CYA +%.0f, CH +%.0f, pH %+.2f", chemical, sanitizer.label, fc*sanitizer.perFC, fc*product.CYAPerPPM, fc*product.CHPerPPM, dpH), true
+	case chemical == "sodium_carbonate" || chemical == "sodium_tetraborate_decahydrate":
+		if unit == "lb" {
+			amount, unit = amount*16, "oz"
+		}
+		if unit != "oz" {
+			return "", false
+		}
+		key := "soda_ash"
+		taRise := taRisePerSodaAshOz
+		if chemical == "sodium_tetraborate_decahydrate" {
+			key, taRise = "borax", taRisePerBoraxOz
+		}
+		ta, ok := water["ta"]
+		if !ok {
+			ta = rules.DefaultTA
+		}
+		dpH := 0.1 * amount / (phIncreaseProducts[key].OzPer10kPerPoint * (ta / 100) * borateFactor(water) * units)
+		bump(water, "ph", dpH)
+		bump(water, "ta", amount*taRise/units)
+		if key == "borax" {
+			bump(water, "borates", amount*boratesPerBoraxOz/units)
+		}
+		return fmt.Sprintf("%s: pH +%.2f, TA +%.0f", chemical, dpH, amount*taRise/units), true
+	case chemical == "boric_acid" && unit == "lb":
+		dBorates := amount / boratesProducts["boric_acid"].LbPerPPMPer10k / units
+		bump(water, "borates", dBorates)
+		return fmt.Sprintf("%s: borates +%.0f", chemical, dBorates), true
+	case chemical == "sodium_bicarbonate" && unit == "lb":
+		dTA := amount / rules.BicarbLbPer10PPMPer10k * 10 / units
+		bump(water, "ta", dTA)
+		return fmt.Sprintf("%s: TA +%.0f", chemical, dTA), true
+	case chemical == "calcium_chloride" && unit == "lb":
+		dCH := amount / rules.CalciumLbPer10PPMPer10k * 10 / units
+		bump(water, "ch", dCH)
+		return fmt.Sprintf("%s: CH +%.0f", chemical, dCH), true
+	case chemical == "cyanuric_acid" && unit == "oz":
+		dCYA := amount / rules.CYAOzPer10PPMPer10k * 10 / units
+		bump(water, "cya", dCYA)
+		return fmt.Sprintf("%s: CYA +%.0f", chemical, dCYA), true
+	case chemical == "sodium_bromide" && unit == "oz":
+		dBromide := amount / bromideOzPerPPMPer10k / units
+		bump(water, "bromide", dBromide)
+		return fmt.Sprintf("%s: bromide +%.0f", chemical, dBromide), true
+	case chemical == "potassium_monopersulfate" && unit == "oz":
+		dBr := amount / mpsOzPerPPMBrPer10k / units
+		bump(water, "br", dBr)
+		return fmt.Sprintf("%s: bromine +%.1f", chemical, dBr), true
+	case strings.HasPrefix(chemical, "phosphate_remover") && unit == "oz":
+		product := phosphateProducts["standard"]
+		if chemical == phosphateProducts["concentrated"].Chemical {
+			product = phosphateProducts["concentrated"]
+		}
+		dPhosphates := math.Min(amount*product.PPBPerOzPer10k/units, water["phosphates"])
+		bump(water, "phosphates", -dPhosphates)
+		return fmt.Sprintf("%s: phosphates -%.0f ppb", chemical, dPhosphates), true
+	case chemical == "enzyme_clarifier" || chemical == "metal_sequestrant":
+		return chemical + ": no change to test readings", true
+	case chemical == "pool_salt" && unit == "lb":
+		dSalt := amount / (units * 10000 * lbPerPPMGallon)
+		bump(water, "salt", dSalt)
+		return fmt.Sprintf("%s: salt +%.0f", chemical, dSalt), true
+	}
+	return "", false
+}
+
+// bump shifts a reading only when it was measured; an unknown reading stays
+// unknown rather than becoming the delta.
+func bump(water map[string]float64, key string, delta float64) {
+	if v, ok := water[key]; ok {
+		water[key] = v + delta
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimulateChlorineAndAcidSideEffects(t *testing.T) {
+	out := Simulate(SimulateInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "ph": 7.9, "ta": 100, "ch": 300, "cya": 40, "salt": 500, "tempF": 80},
+		Doses: []Dose{
+			{Chemical: "liquid_chlorine_10pct", Amount: 38.4, Unit: "oz"},
+			{Chemical: "muriatic_acid_31_45pct", Amount: 6, Unit: "oz"},
+		},
+	})
+	after := out.After
+	if after["fc"] != 4 {
+		t.Fatalf("expected FC 4, got %v", after["fc"])
+	}
+	if math.Abs(after["ph"]-7.46) > 0.01 {
+		t.Fatalf("expected pH near 7.46 after hypochlorite rise and acid drop, got %v", after["ph"])
+	}
+	if after["ta"] >= 100 || after["salt"] <= 500 {
+		t.Fatalf("expected acid to lower TA and chlorine to add salt, got %v", after)
+	}
+	if out.Saturation == nil || len(out.Effects) != 2 {
+		t.Fatalf("expected saturation and two effects, got %+v", out)
+	}
+}
+
+func TestSimulateSaturationUsesCelsius(t *testing.T) {
+	readings := map[string]float64{"ph": 7.5, "ta": 80, "ch": 300, "cya": 30}
+	sim := func(key string, temp float64) *SaturationOutput {
+		water := map[string]float64{key: temp}
+		for k, v := range readings {
+			water[k] = v
+		}
+		return Simulate(SimulateInput{PoolVolumeGallons: 10000, Readings: water}).Saturation
+	}
+	metric, imperial := sim("tempC", 15), sim("tempF", 59)
+	if metric == nil || imperial == nil || metric.CSI != imperial.CSI {
+		t.Fatalf("expected tempC 15 to match tempF 59, got %+v vs %+v", metric, imperial)
+	}
+}
+
+func TestSimulateRoundTripsCalculator(t *testing.T) {
+	in := CalcInput{
+		PoolVolumeGallons: 18000,
+		Readings:          map[string]float64{"fc": 2, "ta": 70, "ch": 200, "cya": 20},
+		Targets:           map[string]float64{"fc": 5, "ta": 90, "ch": 300, "cya": 40},
+		Simulate:          true,
+	}
+	out := CalculateDosing(in)
+	if out.Predicted == nil {
+		t.Fatalf("expected predicted state")
+	}
+	for _, key := range []string{"ta", "ch", "cya"} {
+		if math.Abs(out.Predicted.After[key]-in.Targets[key]) > 0.5 {
+			t.Fatalf("expected %s to reach %v, got %v", key, in.Targets[key], out.Predicted.After[key])
+		}
+	}
+	if math.Abs(out.Predicted.After["fc"]-5) > 0.1 {
+		t.Fatalf("expected fc to reach 5, got %v", out.Predicted.After["fc"])
+	}
+}
+
+func TestSimulateDichlorRaisesCYA(t *testing.T) {
+	out := Simulate(SimulateInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 0, "cya": 40},
+		Doses:             []Dose{{Chemical: "dichlor_56pct", Amount: 35.8, Unit: "oz"}},
+	})
+	if math.Abs(out.After["cya"]-53.5) > 0.2 {
+		t.Fatalf("expected CYA near 53.5, got %v", out.After["cya"])
+	}
+}
+
+func TestSimulateMetricAndUnknownChemical(t *testing.T) {
+	out := Simulate(SimulateInput{
+		UnitSystem:       "metric",
+		PoolVolumeLiters: 37854.1,
+		Readings:         map[string]float64{"ch": 200},
+		Doses: []Dose{
+			{Chemical: "calcium_chloride", Amount: 5.67, Unit: "kg"},
+			{Chemical: "mystery_powder", Amount: 1, Unit: "kg"},
+		},
+	})
+	if math.Abs(out.After["ch"]-300) > 0.5 || out.Confidence != "Low" {
+		t.Fatalf("expected CH 300 with Low confidence, got %+v", out)
+	}
+}
+
+func TestSimulateChlorineRaisesBromine(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 400,
+		BodyOfWater:       BodySpa,
+		SanitizerType:     "bromine",
+		Readings:          map[string]float64{"br": 1, "bromide": 20},
+		Targets:           map[string]float64{"br": 4},
+		Simulate:          true,
+	})
+	if out.Predicted == nil {
+		t.Fatalf("expected predicted state")
+	}
+	after := out.Predicted.After
+	if math.Abs(after["br"]-4) > 0.2 {
+		t.Fatalf("expected bromine to reach 4, got %v", after)
+	}
+	if _, ok := after["fc"]; ok {
+		t.Fatalf("expected chlorine to show up as bromine, not FC, got %v", after)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// TALoweringOptions switches on the acid-and-aeration planner for a TA
+// target below the reading. Each cycle adds acid to bring pH down to
+// AcidToPH, which converts alkalinity to CO2, then aerates to blow the CO2
+// off, which raises pH back without restoring TA.
+type TALoweringOptions struct {
+	AcidToPH       float64 `json:"acidToPh,omitempty"`
+	AerationMethod string  `json:"aerationMethod,omitempty"`
+}
+
+type TALoweringCycle struct {
+	Cycle        int     `json:"cycle"`
+	Acid         Dose    `json:"acid"`
+	AcidToPH     float64 `json:"acidToPh"`
+	AerateHours  float64 `json:"aerateHours"`
+	AerateToPH   float64 `json:"aerateToPh"`
+	PredictedTA  float64 `json:"predictedTa"`
+	Instructions string  `json:"instructions"`
+}
+
+type TALoweringPlan struct {
+	StartTA          float64           `json:"startTa"`
+	TargetTA         float64           `json:"targetTa"`
+	AerationMethod   string            `json:"aerationMethod"`
+	Cycles           []TALoweringCycle `json:"cycles"`
+	TotalAerateHours float64           `json:"totalAerateHours"`
+	PredictedTA      float64           `json:"predictedTa"`
+	Notes            []string          `json:"notes"`
+}
+
+// aerationPHRisePerHour is how fast each method outgasses CO2 at the pH a
+// cycle starts from. Spa jets and air compressors are far faster than
+// pointing the returns up.
+var aerationPHRisePerHour = map[string]float64{
+	"returns":        0.02,
+	"water_feature":  0.04,
+	"spa_jets":       0.08,
+	"air_compressor": 0.1,
+}
+
+const (
+	defaultAerationMethod = "water_feature"
+	defaultAcidToPH       = 7.2
+	// minAcidToPH is the floor of a phenol red test; below it the drop kit
+	// cannot confirm the target and plaster starts to etch.
+	minAcidToPH         = 7.0
+	maxTALoweringCycles = 20
+	taLoweringTolerance = 0.5
+	// carbonicPKa1 is the first carbonic acid pKa in pool water (ionic
+	// strength and temperature corrected).
+	carbonicPKa1 = 6.3
+)
+
+// planTALowering schedules acid and aeration cycles until TA reaches its
+// target, holding pH between AcidToPH and the pH target. Each cycle's acid
+// is the TA the buffer model says it titrates, so dose and drop agree.
+// Cycle 1's acid is this visit's dose and replaces the plain pH-down dose.
+func planTALowering(in CalcInput, pool float64, out *CalcOutput) *TALoweringPlan {
+	target, ta, ok := targetBelow(in, "ta")
+	if !ok {
+		return nil
+	}
+	ph, hasPH := in.Readings["ph"]
+	if !hasPH {
+		out.Missing = append(out.Missing, "ph")
+		return nil
+	}
+	opts := in.TALowering
+	// A pool with no surface type has no pH range; hold at the usual target.
+	holdPH := surfaceRanges[defaultSurface]["ph"].Target
+	if r, ok := out.TargetRanges["ph"]; ok {
+		holdPH = r.Target
+	}
+	if t, ok := in.Targets["ph"]; ok {
+		holdPH = t
+	}
+	acidTo := opts.AcidToPH
+	switch {
+	case acidTo == 0:
+		acidTo = defaultAcidToPH
+	case acidTo < minAcidToPH:
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("TA plan acidToPh %g is below %.1f; using %.1f.", acidTo, minAcidToPH, minAcidToPH))
+		acidTo = minAcidToPH
+	}
+	method := strings.ToLower(strings.TrimSpace(opts.AerationMethod))
+	rate, known := aerationPHRisePerHour[method]
+	if !known {
+		if method != "" {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown aeration method %q; using %s.", opts.AerationMethod, defaultAerationMethod))
+		}
+		method, rate = defaultAerationMethod, aerationPHRisePerHour[defaultAerationMethod]
+	}
+	plan := &TALoweringPlan{StartTA: ta, TargetTA: target, AerationMethod: method, Cycles: []TALoweringCycle{}}
+	if acidTo >= holdPH {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("acidToPh %g must be below the %g pH target; no cycles planned.", acidTo, holdPH))
+		plan.PredictedTA = ta
+		return plan
+	}
+
+	units := pool / 10000
+	cya, borates := in.Readings["cya"], in.Readings["borates"]
+	for cycle := 1; ta > target+taLoweringTolerance; cycle++ {
+		if cycle > maxTALoweringCycles {
+			plan.Notes = append(plan.Notes, fmt.Sprintf("TA target not reached after %d cycles; continue the same cycle daily.", maxTALoweringCycles))
+			break
+		}
+		buffer := newTABuffer(ph, ta, cya, borates)
+		low := math.Min(ph, acidTo)
+		drop := ta - buffer.taAt(low)
+		// The last cycle only needs enough acid to finish the TA drop.
+		if drop > ta-target {
+			drop = ta - target
+			low = buffer.phAt(target, low, ph)
+		}
+		oz := drop / taDropPerAcidOz * units
+		ta -= drop
+		hours := math.Ceil((holdPH-low)/rate*2) / 2
+		plan.Cycles = append(plan.Cycles, TALoweringCycle{
+			Cycle:       cycle,
+			Acid:        Dose{"muriatic_acid_31_45pct", oz, "oz", "Pre-dilute and pour slowly over the deep end with the pump running.", ""},
+			AcidToPH:    round2(low),
+			AerateHours: hours,
+			AerateToPH:  holdPH,
+			PredictedTA: round(ta),
+			Instructions: fmt.Sprintf("Add the acid to bring pH to %.2f, aerate with %s for about %g h until pH reaches %g, then retest pH and TA.",
+				round2(low), strings.ReplaceAll(method, "_", " "), hours, holdPH),
+		})
+		plan.TotalAerateHours += hours
+		ph = holdPH
+	}
+	plan.PredictedTA = round(ta)
+	plan.Notes = append(plan.Notes,
+		"Aeration raises pH without raising TA; if pH climbs faster than predicted, start the next cycle early.",
+		"Keep FC at target throughout; chlorine is more active at low pH, so do not shock mid-plan.",
+	)
+	if len(plan.Cycles) == 0 {
+		return plan
+	}
+	for i, d := range out.Doses {
+		if strings.HasPrefix(d.Chemical, "muriatic_acid") {
+			out.Doses = append(out.Doses[:i], out.Doses[i+1:]...)
+			out.Assumptions = append(out.Assumptions, "pH-down acid folded into the first TA-lowering cycle.")
+			break
+		}
+	}
+	if plan.Cycles[0].Acid.Amount > 0 {
+		out.Doses = append(out.Doses, plan.Cycles[0].Acid)
+	}
+	return plan
+}
+
+// taBuffer models TA against pH while acid is added and before aeration:
+// total carbonate stays fixed, so acid only converts bicarbonate to CO2 and
+// protonates cyanurate and borate. TA lost equals the acid added.
+type taBuffer struct {
+	carbonate, cya, borates float64
+}
+
+func newTABuffer(ph, ta, cya, borates float64) taBuffer {
+	carb := math.Max(0, carbonateAlkalinity(ph, ta, cya, borates))
+	return taBuffer{carb * (1 + math.Pow(10, carbonicPKa1-ph)), cya, borates}
+}
+
+// taAt is the TA at pH p; carbonate alkalinity inverts carbonateAlkalinity.
+func (b taBuffer) taAt(p float64) float64 {
+	return b.carbonate/(1+math.Pow(10, carbonicPKa1-p)) +
+		0.38772*b.cya/(1+math.Pow(10, 6.83-p)) + 4.63*b.borates/(1+math.Pow(10, 9.11-p))
+}
+
+// phAt finds the pH between low and high where TA reaches ta.
+func (b taBuffer) phAt(ta, low, high float64) float64 {
+	for i := 0; i < 40; i++ {
+		mid := (low + high) / 2
+		if b.taAt(mid) > ta {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// metricTALowering reports each cycle's acid in metric units.
+func metricTALowering(plan *TALoweringPlan) {
+	for i := range plan.Cycles {
+		plan.Cycles[i].Acid = metricDose(plan.Cycles[i].Acid)
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingPlansTALowering(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 4, "ph": 7.8, "ta": 120, "cya": 40},
+		Targets:           map[string]float64{"fc": 4, "ph": 7.5, "ta": 90},
+		TALowering:        &TALoweringOptions{AerationMethod: "spa_jets"},
+	})
+	plan := out.TALowering
+	if plan == nil || plan.AerationMethod != "spa_jets" {
+		t.Fatalf("expected a TA plan, got %+v", plan)
+	}
+	if len(plan.Cycles) != 4 || plan.PredictedTA != 90 {
+		t.Fatalf("expected 4 cycles reaching 90, got %+v", plan)
+	}
+	first := plan.Cycles[0]
+	// 7.8 down to 7.2 titrates 12 ppm of TA (30.8 oz at 0.39 ppm/oz), then
+	// 0.3 pH back up at 0.08/h.
+	if first.Acid.Amount != 30.8 || first.AcidToPH != 7.2 || first.AerateHours != 4 || first.PredictedTA != 108 {
+		t.Fatalf("unexpected first cycle: %+v", first)
+	}
+	for i := 1; i < len(plan.Cycles); i++ {
+		if plan.Cycles[i].PredictedTA >= plan.Cycles[i-1].PredictedTA {
+			t.Fatalf("expected TA to fall every cycle, got %+v", plan.Cycles)
+		}
+	}
+	if last := plan.Cycles[3]; last.AcidToPH <= 7.2 || last.Acid.Amount >= plan.Cycles[2].Acid.Amount {
+		t.Fatalf("expected a partial last cycle, got %+v", last)
+	}
+	if len(out.Doses) != 1 || out.Doses[0].Chemical != first.Acid.Chemical || out.Doses[0].Amount != first.Acid.Amount {
+		t.Fatalf("expected only the first cycle's acid as this visit's dose, got %+v", out.Doses)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "folded into the first TA-lowering cycle") {
+		t.Fatalf("expected pH dose folding assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestCalculateDosingTALoweringReachesTypicalTarget(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 20000,
+		Readings:          map[string]float64{"fc": 4, "ph": 7.5, "ta": 140, "cya": 40},
+		Targets:           map[string]float64{"ta": 80},
+		TALowering:        &TALoweringOptions{},
+	})
+	plan := out.TALowering
+	if plan.PredictedTA != 80 || len(plan.Cycles) > 10 || plan.TotalAerateHours > 72 {
+		t.Fatalf("expected 140 to 80 within 10 cycles and 3 days, got %d cycles, %v h, TA %v", len(plan.Cycles), plan.TotalAerateHours, plan.PredictedTA)
+	}
+}
+
+func TestCalculateDosingTALoweringOptions(t *testing.T) {
+	in := CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"ph": 7.5, "ta": 120, "cya": 40},
+		Targets:           map[string]float64{"ta": 90},
+	}
+	out := CalculateDosing(in)
+	if out.TALowering != nil || len(out.Doses) != 0 || !strings.Contains(strings.Join(out.Assumptions, " "), "set taLowering") {
+		t.Fatalf("expected no plan without options, got %+v", out)
+	}
+
+	in.TALowering = &TALoweringOptions{AcidToPH: 6.5, AerationMethod: "bubbles"}
+	out = CalculateDosing(in)
+	assumptions := strings.Join(out.Assumptions, " ")
+	if !strings.Contains(assumptions, "using 7.0") || !strings.Contains(assumptions, `Unknown aeration method "bubbles"`) {
+		t.Fatalf("expected clamped pH and default method, got %v", out.Assumptions)
+	}
+	if out.TALowering.Cycles[0].AcidToPH != 7 || out.TALowering.AerationMethod != defaultAerationMethod {
+		t.Fatalf("unexpected plan: %+v", out.TALowering)
+	}
+
+	in.Readings["ta"] = 180
+	in.TALowering.AcidToPH = 7.4
+	out = CalculateDosing(in)
+	if len(out.TALowering.Cycles) != maxTALoweringCycles || !strings.Contains(strings.Join(out.TALowering.Notes, " "), "not reached") {
+		t.Fatalf("expected a large drop to stop at the cycle limit, got %+v", out.TALowering)
+	}
+
+	in.Readings = map[string]float64{"ta": 120, "cya": 40}
+	out = CalculateDosing(in)
+	if out.TALowering != nil || len(out.Missing) != 1 || out.Missing[0] != "ph" {
+		t.Fatalf("expected pH to be required, got %+v %v", out.TALowering, out.Missing)
+	}
+}
+
+func TestCalculateDosingMetricTALowering(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeLiters: 40000,
+		UnitSystem:       UnitsMetric,
+		Readings:         map[string]float64{"ph": 7.6, "ta": 100, "cya": 40},
+		Targets:          map[string]float64{"ta": 95},
+		TALowering:       &TALoweringOptions{},
+	})
+	if u := out.TALowering.Cycles[0].Acid.Unit; u != "ml" {
+		t.Fatalf("expected cycle acid in ml, got %s", u)
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type FCRecommendation struct {
+	CYA       float64 `json:"cya"`
+	Minimum   float64 `json:"minimum"`
+	Target    float64 `json:"target"`
+	Shock     float64 `json:"shock"`
+	Rationale string  `json:"rationale"`
+}
+
+// fcRatios are the FC-to-CYA fractions behind the recommendation. Salt
+// generators produce chlorine continuously, so they can run a lower ratio.
+var fcRatios = map[bool]struct{ minimum, target, shock float64 }{
+	false: {0.075, 0.115, 0.4},
+	true:  {0.045, 0.07, 0.4},
+}
+
+// RecommendFCTargets derives minimum, target and shock (SLAM) free chlorine
+// levels from the CYA reading. Stabilizer binds most free chlorine, so the
+// levels scale with CYA rather than being fixed numbers.
+func RecommendFCTargets(readings map[string]float64, sanitizerType string, isSalt bool) (FCRecommendation, error) {
+	sanitizer := strings.ToLower(strings.TrimSpace(sanitizerType))
+	if sanitizer == "bromine" {
+		return FCRecommendation{}, fmt.Errorf("FC/CYA targets do not apply to bromine pools")
+	}
+	cya, ok := readings["cya"]
+	if !ok {
+		return FCRecommendation{}, fmt.Errorf("cya reading is required to recommend FC targets")
+	}
+	salt := isSalt || sanitizer == "salt"
+	ratio := fcRatios[salt]
+	rec := FCRecommendation{
+		CYA:     cya,
+		Minimum: math.Max(1, round(cya*ratio.minimum)),
+		Target:  math.Max(3, round(cya*ratio.target)),
+		Shock:   math.Max(10, round(cya*ratio.shock)),
+	}
+	kind := "chlorine"
+	if salt {
+		kind = "salt generator"
+	}
+	rec.Rationale = fmt.Sprintf("FC targets from CYA %.0f (%s): minimum %.1f, target %.1f, shock %.1f ppm.", cya, kind, rec.Minimum, rec.Target, rec.Shock)
+	if fc, ok := readings["fc"]; ok && fc < rec.Minimum {
+		rec.Rationale += fmt.Sprintf(" Current FC %.1f is below the minimum for this CYA.", fc)
+	}
+	if cya > 90 {
+		rec.Rationale += " CYA above 90 makes shocking impractical; consider a partial drain."
+	}
+	return rec, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecommendFCTargetsScalesWithCYA(t *testing.T) {
+	rec, err := RecommendFCTargets(map[string]float64{"cya": 40, "fc": 1}, "chlorine", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Minimum != 3 || rec.Target != 4.6 || rec.Shock != 16 {
+		t.Fatalf("unexpected recommendation: %+v", rec)
+	}
+	if !strings.Contains(rec.Rationale, "below the minimum") {
+		t.Fatalf("expected low FC in rationale, got %q", rec.Rationale)
+	}
+}
+
+func TestRecommendFCTargetsSaltRunsLower(t *testing.T) {
+	chlorine, _ := RecommendFCTargets(map[string]float64{"cya": 70}, "chlorine", false)
+	salt, _ := RecommendFCTargets(map[string]float64{"cya": 70}, "salt", false)
+	if salt.Target >= chlorine.Target || salt.Shock != chlorine.Shock {
+		t.Fatalf("expected lower salt target with same shock: %+v vs %+v", salt, chlorine)
+	}
+}
+
+func TestRecommendFCTargetsRequiresCYA(t *testing.T) {
+	if _, err := RecommendFCTargets(map[string]float64{"fc": 2}, "", false); err == nil {
+		t.Fatalf("expected error without cya")
+	}
+	if _, err := RecommendFCTargets(map[string]float64{"cya": 30}, "bromine", false); err == nil {
+		t.Fatalf("expected error for bromine")
+	}
+}
+
+func TestCalculateDosingAutoTargets(t *testing.T) {
+	in := CalcInput{
+		PoolVolumeGallons: 10000,
+		Readings:          map[string]float64{"fc": 1, "cya": 40},
+		AutoTargets:       true,
+	}
+	out := CalculateDosing(in)
+	if len(out.Doses) != 1 || out.Doses[0].Amount != 46.1 {
+		t.Fatalf("expected 46.1 oz chlorine to reach 4.6 ppm, got %+v", out.Doses)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "FC targets from CYA 40") {
+		t.Fatalf("expected rationale in assumptions, got %v", out.Assumptions)
+	}
+	if in.Targets != nil {
+		t.Fatalf("expected caller targets to be left untouched")
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// testMethodPrecision is the +/- uncertainty of each reading by test method,
+// in the reading's own units. A reading a method does not measure is left
+// out and treated as exact.
+var testMethodPrecision = map[string]map[string]float64{
+	"fas_dpd":    {"fc": 0.5, "cc": 0.5, "ph": 0.1, "ta": 10, "ch": 10, "cya": 10},
+	"oto":        {"fc": 1, "ph": 0.2},
+	"strips":     {"fc": 1.5, "br": 2, "ph": 0.3, "ta": 20, "ch": 50, "cya": 20, "salt": 300, "borates": 15},
+	"photometer": {"fc": 0.1, "cc": 0.1, "br": 0.2, "ph": 0.05, "ta": 5, "ch": 10, "cya": 5, "salt": 100},
+	"sensor":     {"fc": 0.3, "ph": 0.1, "salt": 200},
+}
+
+// coarseDoseSpread is the range width, as a fraction of the dose, above which
+// the reading is too coarse for an exact dose.
+const coarseDoseSpread = 0.5
+
+type DoseRange struct {
+	Chemical string  `json:"chemical"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Unit     string  `json:"unit"`
+}
+
+// readingUncertainty resolves the method for each reading (TestMethods, then
+// TestMethod) and returns the +/- uncertainty for those with precision data.
+func readingUncertainty(in CalcInput, out *CalcOutput) map[string]float64 {
+	uncertainty := map[string]float64{}
+	keys := make([]string, 0, len(in.Readings))
+	for key := range in.Readings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		method := in.TestMethods[key]
+		if method == "" {
+			method = in.TestMethod
+		}
+		if testMethodKey(method) == "" {
+			continue
+		}
+		precision, ok := testMethodPrecision[testMethodKey(method)]
+		if !ok {
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("Unknown test method %q for %s; reading treated as exact.", method, key))
+			continue
+		}
+		if u, ok := precision[key]; ok {
+			uncertainty[key] = u
+		}
+	}
+	return uncertainty
+}
+
+// testMethodKey normalizes a method name, so "FAS-DPD" matches fas_dpd.
+func testMethodKey(method string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(method)))
+}
+
+// doseRanges reruns the calculation with each uncertain reading moved to
+// either end of its precision, one reading at a time, and reports the spread
+// of each dose. That is 2n reruns rather than 2^n corners, so readings that
+// push a dose the same way are not compounded. The reruns work in
+// unrounded oz and lb; the bounds are then converted to each dose's own unit
+// so a range always brackets its dose. Coarse readings add an assumption
+// naming the reading and lower confidence.
+func doseRanges(in CalcInput, uncertainty map[string]float64, doses []Dose, out *CalcOutput) []DoseRange {
+	keys := make([]string, 0, len(uncertainty))
+	for key := range uncertainty {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	base := in
+	base.TestMethod, base.TestMethods = "", nil
+	base.Simulate, base.Dilution = false, nil
+	base.baseUnits = true
+	nominal := map[string]Dose{}
+	for _, d := range CalculateDosing(base).Doses {
+		nominal[d.Chemical] = d
+	}
+	ranges := make([]DoseRange, len(doses))
+	for i, d := range doses {
+		n := nominal[d.Chemical]
+		ranges[i] = DoseRange{d.Chemical, n.Amount, n.Amount, n.Unit}
+	}
+	for _, key := range keys {
+		for _, sign := range []float64{-1, 1} {
+			shifted := base
+			shifted.Readings = make(map[string]float64, len(in.Readings))
+			for k, v := range in.Readings {
+				shifted.Readings[k] = v
+			}
+			shifted.Readings[key] = math.Max(0, in.Readings[key]+sign*uncertainty[key])
+			amounts := map[string]float64{}
+			for _, d := range CalculateDosing(shifted).Doses {
+				amounts[d.Chemical] = d.Amount
+			}
+			for i := range ranges {
+				amount := amounts[ranges[i].Chemical]
+				ranges[i].Min = math.Min(ranges[i].Min, amount)
+				ranges[i].Max = math.Max(ranges[i].Max, amount)
+			}
+		}
+	}
+
+	for i, d := range doses {
+		ranges[i].Min = math.Min(rangeBound(ranges[i].Min, ranges[i].Unit, d), d.Amount)
+		ranges[i].Max = math.Max(rangeBound(ranges[i].Max, ranges[i].Unit, d), d.Amount)
+		ranges[i].Unit = d.Unit
+	}
+
+	coarse := false
+	for i, r := range ranges {
+		if doses[i].Amount > 0 && r.Max-r.Min > coarseDoseSpread*doses[i].Amount {
+			coarse = true
+			out.Assumptions = append(out.Assumptions, fmt.Sprintf("%s could be anywhere from %g to %g %s given test precision (%s); retest with a more precise method before the full dose.", r.Chemical, r.Min, r.Max, r.Unit, precisionSummary(keys, uncertainty)))
+		}
+	}
+	if coarse {
+		out.Confidence = lowerConfidence(out.Confidence)
+	}
+	return ranges
+}
+
+// rangeBound converts a base-unit amount into the unit dose is reported in,
+// rounded the same way.
+func rangeBound(amount float64, unit string, dose Dose) float64 {
+	if unit == dose.Unit {
+		return roundDose(Dose{Chemical: dose.Chemical, Amount: amount, Unit: unit}).Amount
+	}
+	oz, ok := doseOz(dose.Chemical, amount, unit)
+	per, perOK := doseOz(dose.Chemical, 1, dose.Unit)
+	if !ok || !perOK || per == 0 {
+		return dose.Amount
+	}
+	return roundDose(Dose{Chemical: dose.Chemical, Amount: oz / per, Unit: dose.Unit}).Amount
+}
+
+func precisionSummary(keys []string, uncertainty map[string]float64) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s +/-%g", key, uncertainty[key])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingStripsGiveWideRange(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		TestMethod:        "strips",
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if len(out.DoseRanges) != 1 || out.DoseRanges[0].Min != 19.2 || out.DoseRanges[0].Max != 51.2 {
+		t.Fatalf("expected 19.2-51.2 oz range, got %+v", out.DoseRanges)
+	}
+	if out.Doses[0].Amount != 38.4 || out.Confidence != "Low" {
+		t.Fatalf("expected nominal dose with lowered confidence, got %s %+v", out.Confidence, out.Doses)
+	}
+	if !strings.Contains(strings.Join(out.Assumptions, " "), "fc +/-1.5") {
+		t.Fatalf("expected coarse reading assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestCalculateDosingPhotometerKeepsConfidence(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		TestMethods:       map[string]string{"fc": "photometer", "cya": "strips"},
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if out.ReadingUncertainty["fc"] != 0.1 || out.ReadingUncertainty["cya"] != 20 {
+		t.Fatalf("expected per-reading methods, got %v", out.ReadingUncertainty)
+	}
+	if r := out.DoseRanges[0]; r.Min != 37.1 || r.Max != 39.7 || out.Confidence != "Medium" {
+		t.Fatalf("expected narrow range at Medium confidence, got %s %+v", out.Confidence, r)
+	}
+}
+
+func TestCalculateDosingUnknownTestMethod(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		TestMethod:        "Guess Kit",
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if out.DoseRanges != nil || !strings.Contains(strings.Join(out.Assumptions, " "), `Unknown test method "Guess Kit"`) {
+		t.Fatalf("expected unknown method to be treated as exact, got %+v", out)
+	}
+}
+
+func TestCalculateDosingRangesBracketDoseInItsUnit(t *testing.T) {
+	cases := map[string]CalcInput{
+		"spa measures": {
+			PoolVolumeGallons: 400,
+			BodyOfWater:       "spa",
+			TestMethod:        "strips",
+			Readings:          map[string]float64{"fc": 4, "ph": 7.8, "ta": 80, "ch": 150, "cya": 30},
+			Targets:           map[string]float64{"fc": 5, "ph": 7.5, "ch": 200},
+		},
+		"metric": {
+			UnitSystem:       UnitsMetric,
+			PoolVolumeLiters: 40000,
+			TestMethod:       "strips",
+			Readings:         map[string]float64{"fc": 1, "ta": 70, "ch": 200, "cya": 30},
+			Targets:          map[string]float64{"fc": 4, "ta": 90, "ch": 250},
+		},
+	}
+	for name, in := range cases {
+		out := CalculateDosing(in)
+		if len(out.DoseRanges) != len(out.Doses) || len(out.Doses) == 0 {
+			t.Fatalf("%s: expected a range per dose, got %+v", name, out.DoseRanges)
+		}
+		for i, d := range out.Doses {
+			r := out.DoseRanges[i]
+			if r.Unit != d.Unit || r.Min > d.Amount || r.Max < d.Amount {
+				t.Errorf("%s: range %+v does not bracket dose %+v", name, r, d)
+			}
+		}
+	}
+}
+
+func TestCalculateDosingSpaRangeUsesBaseAmounts(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 400,
+		BodyOfWater:       "spa",
+		TestMethod:        "strips",
+		Readings:          map[string]float64{"fc": 3.5, "cya": 30},
+		Targets:           map[string]float64{"fc": 5},
+	})
+	d, r := out.Doses[0], out.DoseRanges[0]
+	// FC 2-5 on strips: the upper bound is 3 ppm, 1.536 oz or 3.07 tbsp,
+	// not 3 in whatever unit that amount would have used on its own.
+	if d.Unit != "tbsp" || r.Unit != "tbsp" || r.Min != 0 || r.Max != 3.1 {
+		t.Fatalf("expected 0-3.1 tbsp around %+v, got %+v", d, r)
+	}
+}
+
+func TestCalculateDosingTestMethodSpelling(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		TestMethod:        "FAS-DPD",
+		TestMethods:       map[string]string{"cya": " Photometer"},
+		Readings:          map[string]float64{"fc": 1, "cya": 30},
+		Targets:           map[string]float64{"fc": 4},
+	})
+	if out.ReadingUncertainty["fc"] != 0.5 || out.ReadingUncertainty["cya"] != 5 {
+		t.Fatalf("expected FAS-DPD to match fas_dpd, got %v", out.ReadingUncertainty)
+	}
+}
+
+func TestCalculateDosingRangesVaryOneReadingAtATime(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		TestMethod:        "strips",
+		Readings:          map[string]float64{"ph": 7.8, "ta": 100, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.4},
+	})
+	// pH +/-0.3 alone spans 1.2-8.4 oz; the pH and TA corners would give
+	// 0.96-10.08 oz.
+	if r := out.DoseRanges[0]; r.Min != 1.2 || r.Max != 8.4 {
+		t.Fatalf("expected acid range 1.2-8.4 oz, got %+v", r)
+	}
+}
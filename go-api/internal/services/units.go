@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	UnitsImperial = "imperial"
+	UnitsMetric   = "metric"
+)
+
+const (
+	litersPerGallon = 3.78541
+	mlPerFluidOz    = 29.5735
+	gramsPerOz      = 28.3495
+	kgPerLb         = 0.453592
+)
+
+// liquidChemicalPrefixes marks doses whose "oz" is a fluid ounce; every other
+// "oz" is a weight ounce.
+var liquidChemicalPrefixes = []string{"liquid_chlorine", "muriatic_acid", "phosphate_remover", "enzyme_clarifier", "metal_sequestrant"}
+
+var imperialInText = regexp.MustCompile(`(\d+(?:\.\d+)?) ?(lb|oz|gallons)\b`)
+
+// resolveUnitSystem maps an optional request value to a known system.
+func resolveUnitSystem(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", UnitsImperial:
+		return UnitsImperial, nil
+	case UnitsMetric:
+		return UnitsMetric, nil
+	default:
+		return UnitsImperial, fmt.Errorf("unitSystem must be imperial or metric")
+	}
+}
+
+func litersToGallons(l float64) float64 { return l / litersPerGallon }
+
+func gallonsToLiters(g float64) float64 { return g * litersPerGallon }
+
+func celsiusToFahrenheit(c float64) float64 { return c*9/5 + 32 }
+
+func fahrenheitToCelsius(f float64) float64 { return (f - 32) * 5 / 9 }
+
+func isLiquidChemical(chemical string) bool {
+	for _, prefix := range liquidChemicalPrefixes {
+		if strings.HasPrefix(chemical, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// metricAmount converts an imperial amount and unit to its metric
+// equivalent. Units without a metric counterpart pass through unchanged.
+func metricAmount(chemical string, amount float64, unit string) (float64, string) {
+	switch unit {
+	case "oz":
+		if isLiquidChemical(chemical) {
+			return amount * mlPerFluidOz, "ml"
+		}
+		return amount * gramsPerOz, "g"
+	case "lb":
+		return amount * kgPerLb, "kg"
+	case "gallons":
+		return gallonsToLiters(amount), "liters"
+	default:
+		return amount, unit
+	}
+}
+
+// imperialAmount is the inverse of metricAmount, for doses supplied by a
+// metric caller.
+func imperialAmount(amount float64, unit string) (float64, string) {
+	switch unit {
+	case "ml":
+		return amount / mlPerFluidOz, "oz"
+	case "g":
+		return amount / gramsPerOz, "oz"
+	case "kg":
+		return amount / kgPerLb, "lb"
+	case "liters":
+		return litersToGallons(amount), "gallons"
+	default:
+		return amount, unit
+	}
+}
+
+func metricDose(d Dose) Dose {
+	d.Amount, d.Unit = metricAmount(d.Chemical, d.Amount, d.Unit)
+	d.Notes = metricText(d.Chemical, d.Notes)
+	return d
+}
+
+// roundDose rounds a dose for display once it is in its final unit; lb and
+// kg keep two decimals except salt, which is weighed by the bag. Doses are
+// carried unrounded until then so a unit change does not compound the
+// rounding.
+func roundDose(d Dose) Dose {
+	if (d.Unit == "lb" || d.Unit == "kg") && !strings.HasPrefix(d.Chemical, "pool_salt") {
+		d.Amount = round2(d.Amount)
+	} else {
+		d.Amount = round(d.Amount)
+	}
+	return d
+}
+
+// metricText rewrites inline quantities such as ">5 lb" in dose notes; ounces
+// become ml or g depending on whether chemical is a liquid.
+func metricText(chemical, s string) string {
+	return imperialInText.ReplaceAllStringFunc(s, func(m string) string {
+		parts := imperialInText.FindStringSubmatch(m)
+		v, _ := strconv.ParseFloat(parts[1], 64)
+		amount, unit := metricAmount(chemical, v, parts[2])
+		return strconv.FormatFloat(round(amount), 'f', -1, 64) + " " + unit
+	})
+}
+
+// normalizeDiagnoseContext returns a copy of ctx with the imperial fields the
+// rules run on filled from their metric counterparts.
+func normalizeDiagnoseContext(ctx *DiagnoseContext) *DiagnoseContext {
+	if ctx == nil {
+		return nil
+	}
+	norm := *ctx
+	if norm.PoolVolumeGallons == nil && norm.PoolVolumeLiters != nil {
+		g := litersToGallons(*norm.PoolVolumeLiters)
+		norm.PoolVolumeGallons = &g
+	}
+	if norm.LatestTest != nil {
+		test := *norm.LatestTest
+		if test.TempF == nil && test.TempC != nil {
+			f := celsiusToFahrenheit(*test.TempC)
+			test.TempF = &f
+		}
+		norm.LatestTest = &test
+	}
+	return &norm
+}
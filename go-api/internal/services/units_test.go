@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingMetric(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		UnitSystem:       "metric",
+		PoolVolumeLiters: 37854.1,
+		Readings:         map[string]float64{"fc": 1, "ta": 60, "cya": 30},
+		Targets:          map[string]float64{"fc": 3, "ta": 100},
+	})
+	if out.UnitSystem != UnitsMetric {
+		t.Fatalf("expected metric output, got %s", out.UnitSystem)
+	}
+	chlorine, bicarb := out.Doses[0], out.Doses[1]
+	if chlorine.Unit != "ml" || chlorine.Amount != 757.1 {
+		t.Fatalf("expected 757.1 ml chlorine, got %+v", chlorine)
+	}
+	if bicarb.Unit != "kg" || bicarb.Amount != 2.54 {
+		t.Fatalf("expected 2.54 kg bicarbonate, got %+v", bicarb)
+	}
+	if !strings.Contains(bicarb.Notes, ">2.3 kg") {
+		t.Fatalf("expected metric note, got %q", bicarb.Notes)
+	}
+}
+
+func TestCalculateDosingMetricMissingVolume(t *testing.T) {
+	out := CalculateDosing(CalcInput{UnitSystem: "metric", Readings: map[string]float64{"cya": 30}})
+	if len(out.Missing) != 1 || out.Missing[0] != "poolVolumeLiters" {
+		t.Fatalf("expected poolVolumeLiters missing, got %v", out.Missing)
+	}
+}
+
+func TestBuildFallbackPlanMetric(t *testing.T) {
+	liters := 120000.0
+	plan := BuildFallbackPlanWithContext("Cloudy water", &DiagnoseContext{UnitSystem: "metric", PoolVolumeLiters: &liters})
+	addition := plan.ChemicalAdditions[0]
+	if addition["unit"] != "ml" || addition["amount"] != "2839" {
+		t.Fatalf("expected 2839 ml for a large metric pool, got %v", addition)
+	}
+}
+
+func TestBuildDiagnoseUserPromptMetric(t *testing.T) {
+	liters := 50000.0
+	tempC := 26.0
+	prompt := buildDiagnoseUserPrompt("Green water", &DiagnoseContext{
+		UnitSystem:       "metric",
+		PoolVolumeLiters: &liters,
+		LatestTest:       &DiagnoseWaterTest{TempC: &tempC},
+	})
+	for _, want := range []string{"Use metric units", "- volume_liters: 50000", "- temp_c: 26.00"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("expected %q in prompt:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "gallons") {
+		t.Fatalf("expected no imperial units in metric prompt:\n%s", prompt)
+	}
+}
+
+func TestValidateDiagnoseRequestRejectsUnknownUnitSystem(t *testing.T) {
+	req := DiagnoseRequest{PoolID: "pool_1", Symptoms: "cloudy", Context: &DiagnoseContext{UnitSystem: "cubits"}}
+	if err := ValidateDiagnoseRequest(req); err == nil {
+		t.Fatalf("expected unit system validation error")
+	}
+}
+
+func TestMetricTextConvertsOunces(t *testing.T) {
+	if got := metricText("liquid_chlorine_10pct", "Add 2 oz at a time"); got != "Add 59.1 ml at a time" {
+		t.Fatalf("expected liquid ounces in ml, got %q", got)
+	}
+	if got := metricText("sodium_bicarbonate", "Split if >4 oz or 5 lb"); got != "Split if >113.4 g or 2.3 kg" {
+		t.Fatalf("expected dry ounces in grams, got %q", got)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// VolumeSection is one body of water. Dimensions are feet, or meters when
+// the request is metric. Width2 is the second lobe width of a kidney shape.
+// Depths, when given, are evenly spaced soundings from shallow to deep end
+// and take precedence over ShallowDepth/DeepDepth.
+type VolumeSection struct {
+	Shape        string    `json:"shape"`
+	Length       float64   `json:"length,omitempty"`
+	Width        float64   `json:"width,omitempty"`
+	Width2       float64   `json:"width2,omitempty"`
+	Diameter     float64   `json:"diameter,omitempty"`
+	ShallowDepth float64   `json:"shallowDepth,omitempty"`
+	DeepDepth    float64   `json:"deepDepth,omitempty"`
+	Depths       []float64 `json:"depths,omitempty"`
+}
+
+type VolumeInput struct {
+	UnitSystem string `json:"unitSystem,omitempty"`
+	VolumeSection
+	Sections []VolumeSection `json:"sections,omitempty"`
+	Spa      *VolumeSection  `json:"spa,omitempty"`
+}
+
+type VolumeOutput struct {
+	Confidence        string   `json:"confidence"`
+	UnitSystem        string   `json:"unitSystem"`
+	PoolVolumeGallons float64  `json:"poolVolumeGallons"`
+	PoolVolumeLiters  float64  `json:"poolVolumeLiters"`
+	SpaVolumeGallons  float64  `json:"spaVolumeGallons,omitempty"`
+	RangeLow          float64  `json:"rangeLow"`
+	RangeHigh         float64  `json:"rangeHigh"`
+	RangeUnit         string   `json:"rangeUnit"`
+	Assumptions       []string `json:"assumptions"`
+	Missing           []string `json:"missingFields"`
+}
+
+const gallonsPerCubicFoot = 7.48052
+
+// shapeUncertainty is the +/- fraction applied to each shape's estimate;
+// irregular outlines are measured less precisely than rectangles.
+var shapeUncertainty = map[string]float64{
+	"rectangular": 0.05,
+	"round":       0.05,
+	"oval":        0.07,
+	"kidney":      0.12,
+}
+
+// freeformUncertainty covers the gaps and overlaps of splitting a freeform
+// outline into simple sections.
+const freeformUncertainty = 0.05
+
+// flatDepthUncertainty is added when only one depth was measured.
+const flatDepthUncertainty = 0.05
+
+// EstimateVolume computes pool volume from shape and dimensions. Freeform
+// pools are the sum of their sections; an attached spa is included in the
+// total because it shares the pool's water.
+func EstimateVolume(in VolumeInput) VolumeOutput {
+	out := VolumeOutput{Confidence: "High", Assumptions: []string{}, Missing: []string{}}
+	system, err := resolveUnitSystem(in.UnitSystem)
+	if err != nil {
+		out.Assumptions = append(out.Assumptions, err.Error()+"; using imperial.")
+	}
+	out.UnitSystem = system
+
+	shape := strings.ToLower(strings.TrimSpace(in.Shape))
+	var sections []VolumeSection
+	if shape == "freeform" {
+		if len(in.Sections) == 0 {
+			out.Missing = append(out.Missing, "sections")
+		}
+		sections = in.Sections
+		out.Assumptions = append(out.Assumptions, "Freeform volume is the sum of its sections.")
+	} else {
+		sections = []VolumeSection{in.VolumeSection}
+	}
+
+	var total, spread float64
+	for i, section := range sections {
+		label := "pool"
+		if shape == "freeform" {
+			label = fmt.Sprintf("sections[%d]", i)
+		}
+		gallons, uncertainty := sectionVolume(section, system, label, &out)
+		total += gallons
+		spread += gallons * uncertainty
+	}
+	if shape == "freeform" {
+		spread += total * freeformUncertainty
+	}
+	if in.Spa != nil {
+		gallons, uncertainty := sectionVolume(*in.Spa, system, "spa", &out)
+		out.SpaVolumeGallons = math.Round(gallons)
+		total += gallons
+		spread += gallons * uncertainty
+	}
+	if len(out.Missing) > 0 {
+		out.Confidence = "Low"
+		return out
+	}
+
+	if total > 0 && spread/total > 0.1 {
+		out.Confidence = "Medium"
+	}
+	out.PoolVolumeGallons = math.Round(total)
+	out.PoolVolumeLiters = math.Round(gallonsToLiters(total))
+	low, high := total-spread, total+spread
+	out.RangeUnit = "gallons"
+	if system == UnitsMetric {
+		low, high = gallonsToLiters(low), gallonsToLiters(high)
+		out.RangeUnit = "liters"
+	}
+	out.RangeLow, out.RangeHigh = math.Round(low), math.Round(high)
+	return out
+}
+
+// sectionVolume returns the gallons in one section and its relative
+// uncertainty, recording missing dimensions under the given label.
+func sectionVolume(s VolumeSection, system, label string, out *VolumeOutput) (float64, float64) {
+	shape := strings.ToLower(strings.TrimSpace(s.Shape))
+	uncertainty, known := shapeUncertainty[shape]
+	if !known {
+		out.Missing = append(out.Missing, label+".shape")
+		return 0, 0
+	}
+	var area float64
+	switch shape {
+	case "rectangular":
+		requireDims(out, label, map[string]float64{"length": s.Length, "width": s.Width})
+		area = s.Length * s.Width
+	case "round":
+		requireDims(out, label, map[string]float64{"diameter": s.Diameter})
+		area = math.Pi * math.Pow(s.Diameter/2, 2)
+	case "oval":
+		requireDims(out, label, map[string]float64{"length": s.Length, "width": s.Width})
+		area = math.Pi * (s.Length / 2) * (s.Width / 2)
+	case "kidney":
+		requireDims(out, label, map[string]float64{"length": s.Length, "width": s.Width, "width2": s.Width2})
+		area = 0.45 * (s.Width + s.Width2) * s.Length
+	}
+
+	depth, flat := averageDepth(s)
+	if depth <= 0 {
+		out.Missing = append(out.Missing, label+".depth")
+		return 0, 0
+	}
+	if flat {
+		uncertainty += flatDepthUncertainty
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("%s: single depth given; assumed flat bottom.", label))
+	}
+
+	if system == UnitsMetric {
+		return litersToGallons(area * depth * 1000), uncertainty
+	}
+	return area * depth * gallonsPerCubicFoot, uncertainty
+}
+
+// averageDepth integrates the depth profile with the trapezoid rule. A
+// shallow/deep pair is a uniform slope; flat reports a single measurement.
+func averageDepth(s VolumeSection) (float64, bool) {
+	if len(s.Depths) == 1 {
+		return s.Depths[0], true
+	}
+	if len(s.Depths) > 1 {
+		var sum float64
+		for i := 1; i < len(s.Depths); i++ {
+			sum += (s.Depths[i-1] + s.Depths[i]) / 2
+		}
+		return sum / float64(len(s.Depths)-1), false
+	}
+	switch {
+	case s.ShallowDepth > 0 && s.DeepDepth > 0:
+		return (s.ShallowDepth + s.DeepDepth) / 2, false
+	case s.ShallowDepth > 0:
+		return s.ShallowDepth, true
+	default:
+		return s.DeepDepth, true
+	}
+}
+
+func requireDims(out *VolumeOutput, label string, dims map[string]float64) {
+	for _, name := range []string{"length", "width", "width2", "diameter"} {
+		if v, ok := dims[name]; ok && v <= 0 {
+			out.Missing = append(out.Missing, label+"."+name)
+		}
+	}
+}
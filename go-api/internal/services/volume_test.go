@@ -0,0 +1,55 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateVolumeRectangularSloped(t *testing.T) {
+	out := EstimateVolume(VolumeInput{VolumeSection: VolumeSection{
+		Shape: "rectangular", Length: 32, Width: 16, ShallowDepth: 3.5, DeepDepth: 6.5,
+	}})
+	if out.PoolVolumeGallons != 19150 || out.Confidence != "High" {
+		t.Fatalf("expected 19150 gallons at High confidence, got %+v", out)
+	}
+	if out.RangeLow >= out.PoolVolumeGallons || out.RangeHigh <= out.PoolVolumeGallons || out.RangeUnit != "gallons" {
+		t.Fatalf("expected range around estimate, got %+v", out)
+	}
+}
+
+func TestEstimateVolumeRoundMetric(t *testing.T) {
+	out := EstimateVolume(VolumeInput{UnitSystem: "metric", VolumeSection: VolumeSection{Shape: "round", Diameter: 5, Depths: []float64{1.2}}})
+	if out.PoolVolumeLiters != 23562 || out.RangeUnit != "liters" {
+		t.Fatalf("expected 23562 liters, got %+v", out)
+	}
+	if len(out.Assumptions) != 1 {
+		t.Fatalf("expected flat-bottom assumption, got %v", out.Assumptions)
+	}
+}
+
+func TestEstimateVolumeFreeformWithSpa(t *testing.T) {
+	out := EstimateVolume(VolumeInput{
+		VolumeSection: VolumeSection{Shape: "freeform"},
+		Sections: []VolumeSection{
+			{Shape: "kidney", Length: 30, Width: 12, Width2: 15, Depths: []float64{3.5, 4, 6, 7}},
+			{Shape: "oval", Length: 10, Width: 8, ShallowDepth: 3, DeepDepth: 3.5},
+		},
+		Spa: &VolumeSection{Shape: "round", Diameter: 7, ShallowDepth: 3},
+	})
+	if out.Confidence != "Medium" {
+		t.Fatalf("expected Medium confidence for freeform, got %s", out.Confidence)
+	}
+	kidney := 0.45 * 27 * 30 * (3.75 + 5 + 6.5) / 3 * gallonsPerCubicFoot
+	oval := math.Pi * 5 * 4 * 3.25 * gallonsPerCubicFoot
+	spa := math.Pi * 3.5 * 3.5 * 3 * gallonsPerCubicFoot
+	if math.Abs(out.PoolVolumeGallons-(kidney+oval+spa)) > 1 || out.SpaVolumeGallons != math.Round(spa) {
+		t.Fatalf("unexpected totals: %+v", out)
+	}
+}
+
+func TestEstimateVolumeMissingDimensions(t *testing.T) {
+	out := EstimateVolume(VolumeInput{VolumeSection: VolumeSection{Shape: "kidney", Length: 20, Width: 10}})
+	if out.Confidence != "Low" || len(out.Missing) != 2 {
+		t.Fatalf("expected width2 and depth missing, got %+v", out.Missing)
+	}
+}
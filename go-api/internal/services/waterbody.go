@@ -0,0 +1,214 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Body-of-water types. Spas and swim spas hold a fraction of a pool's water,
+// run hot and carry far more bathers per gallon, so caps, targets, dose
+// units and retest timing all change with the type.
+const (
+	BodyPool    = "pool"
+	BodySpa     = "spa"
+	BodySwimSpa = "swim_spa"
+)
+
+type TargetRange struct {
+	Min    float64 `json:"min"`
+	Target float64 `json:"target"`
+	Max    float64 `json:"max"`
+}
+
+// waterBodyProfile holds what differs per body of water. Ranges fill missing
+// targets; a reading outside its range is dosed back to Target.
+type waterBodyProfile struct {
+	RetestHours    int
+	DefaultGallons float64
+	// ScaleCaps shrinks every per-addition cap in proportion to the volume,
+	// since the pool caps are sized for 10k gallons and up.
+	ScaleCaps bool
+	// Measures expresses imperial doses in teaspoons and tablespoons.
+	Measures bool
+	Ranges   map[string]TargetRange
+}
+
+var waterBodyProfiles = map[string]waterBodyProfile{
+	BodyPool: {RetestHours: 4},
+	BodySpa: {RetestHours: 1, DefaultGallons: 400, ScaleCaps: true, Measures: true, Ranges: map[string]TargetRange{
+		"ph": {7.4, 7.5, 7.8},
+		"ta": {50, 70, 80},
+		"ch": {150, 200, 250},
+		"br": {4, 5, 6},
+	}},
+	BodySwimSpa: {RetestHours: 2, DefaultGallons: 2000, ScaleCaps: true, Measures: true, Ranges: map[string]TargetRange{
+		"ph": {7.2, 7.5, 7.8},
+		"ta": {60, 70, 90},
+		"ch": {150, 200, 300},
+		"br": {3, 4, 5},
+	}},
+}
+
+const (
+	// Industry rule for spa water replacement: gallons / 3 / daily bathers.
+	refillGallonsPerBather = 3
+	defaultBathersPerDay   = 2
+	// teaspoonsPerFluidOz and the per-chemical densities below turn small
+	// doses into kitchen measures.
+	teaspoonsPerFluidOz    = 6
+	teaspoonsPerTablespoon = 3
+	maxMeasureTablespoons  = 16
+)
+
+// gramsPerTeaspoon is the bulk density of each dry product; unknown
+// chemicals use defaultGramsPerTeaspoon.
+var gramsPerTeaspoon = map[string]float64{
+	"sodium_bicarbonate":       4.6,
+	"boric_acid":               4.5,
+	"sodium_carbonate":         4.8,
+	"sodium_tetraborate":       4.0,
+	"calcium_chloride":         4.5,
+	"cyanuric_acid":            3.5,
+	"dichlor":                  5.0,
+	"cal_hypo":                 5.5,
+	"lithium_hypo":             5.0,
+	"potassium_monopersulfate": 5.0,
+	"sodium_bromide":           5.5,
+	"pool_salt":                6.0,
+}
+
+const defaultGramsPerTeaspoon = 5.0
+
+// poundChemicals are dosed in lb by the calculator and simulator.
+var poundChemicals = []string{"sodium_bicarbonate", "calcium_chloride", "pool_salt", "boric_acid"}
+
+// resolveBodyOfWater maps an optional request value to a known type.
+func resolveBodyOfWater(value string) (string, error) {
+	v := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(value)))
+	switch v {
+	case "", BodyPool:
+		return BodyPool, nil
+	case BodySpa, "hot_tub", "hottub":
+		return BodySpa, nil
+	case BodySwimSpa, "swimspa":
+		return BodySwimSpa, nil
+	default:
+		return BodyPool, fmt.Errorf("bodyOfWater must be pool, spa or swim_spa")
+	}
+}
+
+// doseCap scales a pool-sized cap down for spas and swim spas.
+func doseCap(in CalcInput, pool, max float64) float64 {
+	if waterBodyProfiles[in.BodyOfWater].ScaleCaps {
+		return max * math.Min(1, pool/10000)
+	}
+	return max
+}
+
+func gramsPerTeaspoonFor(chemical string) float64 {
+	for prefix, g := range gramsPerTeaspoon {
+		if strings.HasPrefix(chemical, prefix) {
+			return g
+		}
+	}
+	return defaultGramsPerTeaspoon
+}
+
+func isPoundChemical(chemical string) bool {
+	for _, prefix := range poundChemicals {
+		if strings.HasPrefix(chemical, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// householdMeasure rewrites a small imperial dose in teaspoons or
+// tablespoons. Doses larger than a cup, and units that are not a weight or
+// volume (tablets), keep their original unit.
+func householdMeasure(d Dose) Dose {
+	oz := d.Amount
+	switch d.Unit {
+	case "oz":
+	case "lb":
+		oz = d.Amount * 16
+	default:
+		return d
+	}
+	tsp := oz * teaspoonsPerFluidOz
+	if !isLiquidChemical(d.Chemical) {
+		tsp = oz * gramsPerOz / gramsPerTeaspoonFor(d.Chemical)
+	}
+	switch {
+	case tsp < teaspoonsPerTablespoon:
+		d.Amount, d.Unit = tsp, "tsp"
+	case tsp/teaspoonsPerTablespoon <= maxMeasureTablespoons:
+		d.Amount, d.Unit = tsp/teaspoonsPerTablespoon, "tbsp"
+	}
+	return d
+}
+
+// measureAmount is the inverse of householdMeasure, returning the amount in
+// the unit the simulator models for the chemical.
+func measureAmount(chemical string, amount float64, unit string) (float64, string) {
+	tsp := amount
+	switch unit {
+	case "tsp":
+	case "tbsp":
+		tsp = amount * teaspoonsPerTablespoon
+	default:
+		return amount, unit
+	}
+	if isLiquidChemical(chemical) {
+		return tsp / teaspoonsPerFluidOz, "oz"
+	}
+	oz := tsp * gramsPerTeaspoonFor(chemical) / gramsPerOz
+	if isPoundChemical(chemical) {
+		return oz / 16, "lb"
+	}
+	return oz, "oz"
+}
+
+// smallMetricDose keeps spa doses under a kilogram in grams.
+func smallMetricDose(d Dose) Dose {
+	if d.Unit == "kg" && d.Amount < 1 {
+		d.Amount, d.Unit = d.Amount*1000, "g"
+	}
+	return d
+}
+
+// refillDays is how long spa water lasts at the given bather load before
+// dissolved solids make it hard to keep balanced.
+func refillDays(gallons, bathersPerDay float64) int {
+	return int(math.Max(1, math.Floor(gallons/refillGallonsPerBather/bathersPerDay)))
+}
+
+// spaRefill sets the drain-and-refill interval for spas and swim spas.
+func spaRefill(in CalcInput, pool float64, out *CalcOutput) {
+	bathers := in.BathersPerDay
+	if bathers <= 0 {
+		bathers = defaultBathersPerDay
+		out.Assumptions = append(out.Assumptions, fmt.Sprintf("Bather load not provided; refill interval assumes %d bathers per day.", defaultBathersPerDay))
+	}
+	out.RefillInDays = refillDays(pool, bathers)
+}
+
+// waterBodyFallback adjusts the fallback plan for spas and swim spas: an
+// amount sized to the small volume and a drain-and-refill reminder.
+func waterBodyFallback(body string, context *DiagnoseContext, addition map[string]string, bromine bool) []string {
+	gallons := *context.PoolVolumeGallons
+	steps := []string{fmt.Sprintf("Drain and refill about every %d days at %d bathers per day; sooner with heavier use", refillDays(gallons, defaultBathersPerDay), defaultBathersPerDay)}
+	if addition == nil {
+		return steps
+	}
+	hours := waterBodyProfiles[body].RetestHours
+	oz := gallons / 10000 * mpsFallbackOzPer10k
+	if !bromine {
+		// Liquid chlorine for a 3 ppm rise.
+		oz = 3 * gallons / (10000 * 10) * 128
+	}
+	addition["amount"] = fmt.Sprintf("%g", round2(oz))
+	addition["instructions"] = fmt.Sprintf("Add with the jets running and the cover off, retest in %d hour(s).", hours)
+	return steps
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDosingSpaUsesMeasuresAndRanges(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 400,
+		BodyOfWater:       "hot tub",
+		AutoTargets:       true,
+		Readings:          map[string]float64{"fc": 2, "ph": 8.0, "ta": 80, "cya": 30},
+		Targets:           map[string]float64{"fc": 5},
+	})
+	if out.BodyOfWater != BodySpa || out.RetestHours != 1 {
+		t.Fatalf("expected spa with 1h retest, got %s %d", out.BodyOfWater, out.RetestHours)
+	}
+	if len(out.Doses) != 2 {
+		t.Fatalf("expected chlorine and acid doses, got %+v", out.Doses)
+	}
+	if d := out.Doses[0]; d.Chemical != "liquid_chlorine_10pct" || d.Amount != 3.1 || d.Unit != "tbsp" {
+		t.Fatalf("unexpected chlorine dose: %+v", d)
+	}
+	if d := out.Doses[1]; d.Chemical != "muriatic_acid_31_45pct" || d.Amount != 1.2 || d.Unit != "tsp" {
+		t.Fatalf("unexpected acid dose: %+v", d)
+	}
+	if out.Sequence[0].Unit != "tsp" {
+		t.Fatalf("expected sequence in measures, got %+v", out.Sequence)
+	}
+	if out.TargetRanges["ph"].Target != 7.5 {
+		t.Fatalf("expected spa ranges in output, got %+v", out.TargetRanges)
+	}
+	if out.RefillInDays != 66 {
+		t.Fatalf("expected 66 day refill at default bather load, got %d", out.RefillInDays)
+	}
+}
+
+func TestCalculateDosingSpaMeasuresUnroundedDose(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 400,
+		BodyOfWater:       "spa",
+		Readings:          map[string]float64{"fc": 5, "ph": 7.9, "ta": 80, "cya": 30},
+		Targets:           map[string]float64{"ph": 7.5},
+	})
+	// 0.1536 oz is 0.92 tsp; rounding to 0.2 oz first would give 1.2 tsp.
+	if d := out.Doses[0]; d.Amount != 0.9 || d.Unit != "tsp" {
+		t.Fatalf("expected 0.9 tsp of acid, got %+v", d)
+	}
+	metric := CalculateDosing(CalcInput{
+		UnitSystem:       UnitsMetric,
+		PoolVolumeLiters: 1500,
+		BodyOfWater:      "spa",
+		Readings:         map[string]float64{"fc": 5, "ta": 80, "ch": 100, "cya": 30},
+		Targets:          map[string]float64{"ch": 150},
+	})
+	// 0.2477 lb of calcium chloride is 112.3 g, not the 110 g of 0.11 kg.
+	if d := metric.Doses[0]; d.Amount != 112.3 || d.Unit != "g" {
+		t.Fatalf("expected 112.3 g of calcium chloride, got %+v", d)
+	}
+}
+
+func TestBuildFallbackPlanSpaMetricVolume(t *testing.T) {
+	plan := BuildFallbackPlanWithContext("cloudy", &DiagnoseContext{BodyOfWater: "spa", UnitSystem: UnitsMetric})
+	if steps := strings.Join(plan.Steps, " | "); !strings.Contains(steps, "assume 1514 liters") {
+		t.Fatalf("expected metric volume assumption, got %v", plan.Steps)
+	}
+	if addition := plan.ChemicalAdditions[0]; addition["unit"] != "ml" || addition["amount"] != "45.5" {
+		t.Fatalf("expected a small metric spa dose, got %v", addition)
+	}
+}
+
+func TestCalculateDosingSpaScalesCaps(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 400,
+		BodyOfWater:       BodySpa,
+		BathersPerDay:     4,
+		Readings:          map[string]float64{"fc": 0, "cya": 30},
+		Targets:           map[string]float64{"fc": 60},
+	})
+	if d := out.Doses[0]; d.Amount != 20.5 || d.Unit != "oz" {
+		t.Fatalf("expected chlorine capped at 512 oz x 400/10k, got %+v", d)
+	}
+	if out.RefillInDays != 33 {
+		t.Fatalf("expected 33 day refill at 4 bathers, got %d", out.RefillInDays)
+	}
+}
+
+func TestCalculateDosingPoolIgnoresBodyRanges(t *testing.T) {
+	// pH 7.3 and TA 95 are outside the spa ranges but inside the pool's.
+	out := CalculateDosing(CalcInput{
+		PoolVolumeGallons: 10000,
+		AutoTargets:       true,
+		Readings:          map[string]float64{"fc": 3, "ph": 7.3, "ta": 95, "cya": 30},
+		Targets:           map[string]float64{"fc": 3},
+	})
+	if out.BodyOfWater != BodyPool || out.RetestHours != 4 || len(out.Doses) != 0 || out.RefillInDays != 0 {
+		t.Fatalf("expected pool behavior unchanged, got %+v", out)
+	}
+}
+
+func TestCalculateDosingMetricSpaUsesGrams(t *testing.T) {
+	out := CalculateDosing(CalcInput{
+		PoolVolumeLiters: 1500,
+		UnitSystem:       UnitsMetric,
+		BodyOfWater:      BodySpa,
+		Readings:         map[string]float64{"ta": 40, "cya": 30},
+		Targets:          map[string]float64{"ta": 70},
+	})
+	if d := out.Doses[0]; d.Chemical != "sodium_bicarbonate" || d.Unit != "g" || d.Amount <= 0 {
+		t.Fatalf("expected bicarbonate in grams, got %+v", d)
+	}
+}
+
+func TestSimulateReadsMeasures(t *testing.T) {
+	out := Simulate(SimulateInput{
+		PoolVolumeGallons: 400,
+		Readings:          map[string]float64{"fc": 2},
+		Doses:             []Dose{{"liquid_chlorine_10pct", 3, "tbsp", "", ""}},
+	})
+	if out.After["fc"] != 4.9 {
+		t.Fatalf("expected 3 tbsp to add about 2.9 ppm, got %v", out.After)
+	}
+}
+
+func TestBuildFallbackPlanSpa(t *testing.T) {
+	fc := 1.0
+	plan := BuildFallbackPlanWithContext("cloudy", &DiagnoseContext{BodyOfWater: "spa", LatestTest: &DiagnoseWaterTest{FC: &fc}})
+	if plan.RetestInHours != 1 {
+		t.Fatalf("expected 1h retest, got %d", plan.RetestInHours)
+	}
+	add := plan.ChemicalAdditions[0]
+	if add["amount"] != "3.1" || add["unit"] != "tbsp" {
+		t.Fatalf("expected spa-sized chlorine, got %v", add)
+	}
+	steps := strings.Join(plan.Steps, " | ")
+	if !strings.Contains(steps, "assume 400 gallons") || !strings.Contains(steps, "every 66 days") {
+		t.Fatalf("expected volume assumption and refill step, got %v", plan.Steps)
+	}
+}
+
+func TestBuildFallbackPlanBromineSpa(t *testing.T) {
+	gallons := 400.0
+	plan := BuildFallbackPlanWithContext("", &DiagnoseContext{BodyOfWater: "spa", SanitizerType: "bromine", PoolVolumeGallons: &gallons})
+	add := plan.ChemicalAdditions[0]
+	if add["chemical"] != "potassium_monopersulfate" || add["amount"] != "1.2" || add["unit"] != "tbsp" {
+		t.Fatalf("expected spa-sized MPS, got %v", add)
+	}
+}
+
+func TestValidateDiagnoseRequestRejectsUnknownBody(t *testing.T) {
+	err := ValidateDiagnoseRequest(DiagnoseRequest{PoolID: "p1", Symptoms: "cloudy", Context: &DiagnoseContext{BodyOfWater: "lake"}})
+	if err == nil {
+		t.Fatal("expected unknown bodyOfWater to be rejected")
+	}
+}
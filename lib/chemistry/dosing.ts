@@ -15,12 +15,17 @@ export type CalculatorOutput = {
   retestInHours: number;
 };
 
-const cap = (amount: number, max: number) => Math.min(Math.max(0, amount), max);
+// Caps a single addition and records the cap so the user knows to retest and finish later.
+const cap = (amount: number, max: number, chemical: string, unit: string, capNotes: string[]) => {
+  if (amount > max) capNotes.push(`${chemical} capped at ${max} ${unit} per addition; retest before dosing the remainder.`);
+  return Math.min(Math.max(0, amount), max);
+};
 
 // Rule-of-thumb formulas based on common pool industry approximation tables.
 export function calculateDosing(input: CalculatorInput): CalculatorOutput {
   const missing: string[] = [];
   const doses: Dose[] = [];
+  const capNotes: string[] = [];
   const pool = input.poolVolumeGallons;
   if (!pool) missing.push('poolVolumeGallons');
 
@@ -30,33 +35,34 @@ export function calculateDosing(input: CalculatorInput): CalculatorOutput {
   if (pool && readings.fc !== undefined && targets.fc !== undefined && targets.fc > readings.fc) {
     const delta = targets.fc - readings.fc;
     const gallons = (delta * pool) / (10000 * lcPercent);
-    const oz = cap(gallons * 128, 512);
-    doses.push({ chemical: `liquid_chlorine_${lcPercent}pct`, amount: Number(oz.toFixed(1)), unit: 'oz', notes: 'Add half dose, circulate 30-60 min, retest before adding remainder.' });
+    const chemical = `liquid_chlorine_${lcPercent}pct`;
+    const oz = cap(gallons * 128, 512, chemical, 'oz', capNotes);
+    doses.push({ chemical, amount: Number(oz.toFixed(1)), unit: 'oz', notes: 'Add half dose, circulate 30-60 min, retest before adding remainder.' });
   }
 
   if (pool && readings.ph !== undefined && targets.ph !== undefined && readings.ph > targets.ph) {
     const ta = readings.ta ?? 90;
     const phDelta = readings.ph - targets.ph;
     const baseOzPer10k = phDelta * 12 * (ta / 100);
-    const oz = cap(baseOzPer10k * (pool / 10000), 64);
+    const oz = cap(baseOzPer10k * (pool / 10000), 64, 'muriatic_acid_31_45pct', 'oz', capNotes);
     doses.push({ chemical: 'muriatic_acid_31_45pct', amount: Number(oz.toFixed(1)), unit: 'oz', notes: 'Conservative first-step estimate; pre-dilute and pour slowly with pump running.' });
   }
 
   if (pool && readings.ta !== undefined && targets.ta !== undefined && targets.ta > readings.ta) {
     const delta = targets.ta - readings.ta;
-    const lbs = cap((delta / 10) * (pool / 10000) * 1.4, 25);
+    const lbs = cap((delta / 10) * (pool / 10000) * 1.4, 25, 'sodium_bicarbonate', 'lb', capNotes);
     doses.push({ chemical: 'sodium_bicarbonate', amount: Number(lbs.toFixed(2)), unit: 'lb', notes: 'Split into 2 additions if >5 lb.' });
   }
 
   if (pool && readings.ch !== undefined && targets.ch !== undefined && targets.ch > readings.ch) {
     const delta = targets.ch - readings.ch;
-    const lbs = cap((delta / 10) * (pool / 10000) * 1.25, 30);
+    const lbs = cap((delta / 10) * (pool / 10000) * 1.25, 30, 'calcium_chloride', 'lb', capNotes);
     doses.push({ chemical: 'calcium_chloride', amount: Number(lbs.toFixed(2)), unit: 'lb', notes: 'Dissolve as directed; add in portions.' });
   }
 
   if (pool && readings.cya !== undefined && targets.cya !== undefined && targets.cya > readings.cya) {
     const delta = targets.cya - readings.cya;
-    const oz = cap((delta / 10) * (pool / 10000) * 13, 128);
+    const oz = cap((delta / 10) * (pool / 10000) * 13, 128, 'cyanuric_acid', 'oz', capNotes);
     doses.push({ chemical: 'cyanuric_acid', amount: Number(oz.toFixed(1)), unit: 'oz', notes: 'Add via sock method; avoid backwashing for 24-48h.' });
   }
 
@@ -69,6 +75,7 @@ export function calculateDosing(input: CalculatorInput): CalculatorOutput {
     assumptions: [
       'Conservative first-step dosing. Exact demand varies by water conditions and product brand.',
       'Never mix chemicals directly. Add one chemical at a time with circulation running.',
+      ...capNotes,
     ],
     safetyNotes: [
       'Wear PPE and follow manufacturer labels.',
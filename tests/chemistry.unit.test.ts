@@ -1,5 +1,12 @@
 import { describe, expect, it } from 'vitest';
-import { calculateDosing } from '../lib/chemistry/dosing';
+import { calculateDosing, type CalculatorInput, type CalculatorOutput } from '../lib/chemistry/dosing';
+import golden from '../go-api/internal/services/testdata/dosing_golden.json';
+
+type GoldenCase = {
+  name: string;
+  input: CalculatorInput;
+  expected: Pick<CalculatorOutput, 'confidence' | 'doses' | 'assumptions' | 'missingFields'>;
+};
 
 describe('calculateDosing', () => {
   it('calculates chlorine dose', () => {
@@ -14,4 +21,13 @@ describe('calculateDosing', () => {
     expect(result.confidence).toBe('Low');
     expect(result.missingFields).toContain('poolVolumeGallons');
   });
+
+  // Shared with go-api services.CalculateDosing so both calculators stay in lockstep.
+  it.each(golden as GoldenCase[])('matches golden vector: $name', ({ input, expected }) => {
+    const result = calculateDosing(input);
+    expect(result.confidence).toBe(expected.confidence);
+    expect(result.missingFields).toEqual(expected.missingFields);
+    expect(result.assumptions).toEqual(expected.assumptions);
+    expect(result.doses.map(({ chemical, amount, unit }) => ({ chemical, amount, unit }))).toEqual(expected.doses);
+  });
 });